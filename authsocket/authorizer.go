@@ -0,0 +1,47 @@
+package authsocket
+
+import "context"
+
+// AuthorizationRequest describes a client whose handshake signature and
+// certificates have been verified.
+type AuthorizationRequest struct {
+	// IdentityKey is the client's proven identity key.
+	IdentityKey string
+	// Certificates holds the verified certificates the client presented.
+	Certificates []Certificate
+	// Metadata describes the connection, for transports that implement
+	// transport.MetadataProvider.
+	Metadata map[string]string
+}
+
+// Decision is an Authorizer's verdict on a client.
+type Decision struct {
+	Allow bool
+	// Reason explains a denial; it is included in the handshake error.
+	Reason string
+	// Claims are attached to the session of an allowed client.
+	Claims map[string]interface{}
+}
+
+// Allow returns a Decision admitting the client with the given claims.
+func Allow(claims map[string]interface{}) Decision {
+	return Decision{Allow: true, Claims: claims}
+}
+
+// Deny returns a Decision refusing the client for reason.
+func Deny(reason string) Decision {
+	return Decision{Reason: reason}
+}
+
+// Authorizer decides whether an authenticated client may open a session.
+// It runs before the server sends ok, so denied clients never see a session.
+type Authorizer interface {
+	Authorize(ctx context.Context, req AuthorizationRequest) (Decision, error)
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface.
+type AuthorizerFunc func(ctx context.Context, req AuthorizationRequest) (Decision, error)
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, req AuthorizationRequest) (Decision, error) {
+	return f(ctx, req)
+}
@@ -0,0 +1,53 @@
+package authsocket
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAuthorizerAttachesClaims(t *testing.T) {
+	var got AuthorizationRequest
+	authorizer := AuthorizerFunc(func(_ context.Context, req AuthorizationRequest) (Decision, error) {
+		got = req
+		return Allow(map[string]interface{}{"role": "admin"}), nil
+	})
+	_, session, _, err := runHandshakePair(t, nil, nil, []ServerOption{WithAuthorizer(authorizer)})
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if got.IdentityKey != session.PeerIdentityKey {
+		t.Fatalf("authorizer saw identity %s, want %s", got.IdentityKey, session.PeerIdentityKey)
+	}
+	if got.Metadata["remoteAddr"] != "10.0.0.7:5000" {
+		t.Fatalf("authorizer saw metadata %v", got.Metadata)
+	}
+	if session.Claims()["role"] != "admin" {
+		t.Fatalf("session claims = %v, want role admin", session.Claims())
+	}
+}
+
+func TestAuthorizerDenies(t *testing.T) {
+	authorizer := AuthorizerFunc(func(context.Context, AuthorizationRequest) (Decision, error) {
+		return Deny("identity is banned"), nil
+	})
+	_, _, _, err := runHandshakePair(t, nil, nil, []ServerOption{WithAuthorizer(authorizer)})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "identity is banned") {
+		t.Fatalf("denial reason missing from %q", err)
+	}
+}
+
+func TestAuthorizerError(t *testing.T) {
+	boom := errors.New("policy backend unavailable")
+	authorizer := AuthorizerFunc(func(context.Context, AuthorizationRequest) (Decision, error) {
+		return Decision{}, boom
+	})
+	_, _, _, err := runHandshakePair(t, nil, nil, []ServerOption{WithAuthorizer(authorizer)})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected authorizer error, got %v", err)
+	}
+}
@@ -4,50 +4,113 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
 	"github.com/sirdeggen/go-authsocket/authsocket/transport"
-	"github.com/sirdeggen/go-authsocket/internal/wire"
 )
 
 // AuthSocketClient mimics the TypeScript AuthSocket client.
 // It wraps a transport, performs handshake, and handles events.
 type AuthSocketClient struct {
-	transport    transport.Transport
-	wallet       *wire.KeyPair
-	handshaked   bool
-	eventMutex   sync.RWMutex
-	eventHandlers map[string][]func(data interface{})
+	wallet Wallet
+	opts   []ClientOption
+	// connMutex guards the current connection, which Reconnect replaces
+	// while Emit and the listener may be using it.
+	connMutex          sync.RWMutex
+	transport          transport.Transport
+	handshaked         bool
+	session            *Session
+	stopListening      context.CancelFunc
+	eventMutex         sync.RWMutex
+	eventHandlers      map[string][]func(data interface{})
+	errorHandlers      []func(err error)
+	disconnectHandlers []func(err error)
 }
 
 // NewAuthSocketClient creates a new client with the given transport and wallet.
-func NewAuthSocketClient(transport transport.Transport, wallet *wire.KeyPair) *AuthSocketClient {
+// Options such as WithServerIdentityKeys are applied to the handshake.
+func NewAuthSocketClient(transport transport.Transport, wallet Wallet, opts ...ClientOption) *AuthSocketClient {
 	return &AuthSocketClient{
 		transport:     transport,
 		wallet:        wallet,
+		opts:          opts,
 		eventHandlers: make(map[string][]func(data interface{})),
 	}
 }
 
 // Connect performs the handshake over the transport.
 func (c *AuthSocketClient) Connect(ctx context.Context) error {
-	if c.handshaked {
+	t, _, handshaked := c.conn()
+	if handshaked {
 		return nil
 	}
 
-	err := RunClientHandshake(ctx, c.transport, c.wallet)
+	session, err := RunClientHandshake(ctx, t, c.wallet, c.opts...)
 	if err != nil {
 		return err
 	}
 
-	c.handshaked = true
-
 	// Start listening for incoming messages
-	go c.listenForMessages(ctx)
+	c.listen(ctx, t, session)
+
+	return nil
+}
 
+// Reconnect restores the connection over a new transport after the old one
+// failed. If the server issued a resumption ticket (see WithResumption) the
+// session continues in one round trip; otherwise, or if the server rejects
+// the ticket, a full handshake establishes a new session. Registered handlers
+// are kept either way.
+func (c *AuthSocketClient) Reconnect(ctx context.Context, t transport.Transport) error {
+	_, previous, _ := c.conn()
+	session, err := RunClientResumption(ctx, t, c.wallet, previous, c.opts...)
+	if err != nil {
+		return err
+	}
+	c.listen(ctx, t, session)
 	return nil
 }
 
+// listen makes t and session the current connection, stopping the listener
+// of the previous one, and dispatches messages from t until ctx is done or
+// the transport is replaced.
+func (c *AuthSocketClient) listen(ctx context.Context, t transport.Transport, session *Session) {
+	ctx, stop := context.WithCancel(ctx)
+	c.connMutex.Lock()
+	if c.stopListening != nil {
+		c.stopListening()
+	}
+	c.transport = t
+	c.session = session
+	c.handshaked = true
+	c.stopListening = stop
+	c.connMutex.Unlock()
+	go c.listenForMessages(ctx, t, session)
+}
+
+// conn returns the current transport and session, and whether the session
+// is connected.
+func (c *AuthSocketClient) conn() (transport.Transport, *Session, bool) {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.transport, c.session, c.handshaked
+}
+
+// ServerIdentityKey returns the identity key the server proved during the
+// handshake, or "" before Connect has succeeded.
+func (c *AuthSocketClient) ServerIdentityKey() string {
+	_, session, _ := c.conn()
+	if session == nil {
+		return ""
+	}
+	return session.PeerIdentityKey
+}
+
 // On registers an event handler.
 func (c *AuthSocketClient) On(event string, handler func(data interface{})) {
 	c.eventMutex.Lock()
@@ -55,70 +118,126 @@ func (c *AuthSocketClient) On(event string, handler func(data interface{})) {
 	c.eventHandlers[event] = append(c.eventHandlers[event], handler)
 }
 
-// Emit sends an event with data.
+// OnError registers a handler for incoming messages that were dropped,
+// such as ones whose signature does not verify against the server identity.
+func (c *AuthSocketClient) OnError(handler func(err error)) {
+	c.eventMutex.Lock()
+	defer c.eventMutex.Unlock()
+	c.errorHandlers = append(c.errorHandlers, handler)
+}
+
+// OnDisconnect registers a handler for the loss of the connection, such as
+// the server closing it or no longer answering keepalive pings (see
+// transport.ErrPeerDead). The transport is closed by then; Reconnect can
+// restore the session over a new one.
+func (c *AuthSocketClient) OnDisconnect(handler func(err error)) {
+	c.eventMutex.Lock()
+	defer c.eventMutex.Unlock()
+	c.disconnectHandlers = append(c.disconnectHandlers, handler)
+}
+
+// Emit sends an event with data, signed under the session.
 func (c *AuthSocketClient) Emit(ctx context.Context, event string, data interface{}) error {
-	if !c.handshaked {
+	t, session, handshaked := c.conn()
+	if !handshaked {
 		return ErrNotConnected
 	}
 
-	msg := wire.AuthMessage{
-		Version: "1",
-		Type:    "general",
-		Payload: []int{}, // Empty for now, could encode data
-	}
-	// For simplicity, encode event and data as JSON in payload
-	payloadData, err := json.Marshal(map[string]interface{}{"event": event, "data": data})
+	payload, err := encodeEvent(event, data)
 	if err != nil {
 		return err
 	}
-	msg.Payload = IntsFromBytes(payloadData)
 
-	raw, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
-	return c.transport.Send(ctx, raw)
+	return session.send(ctx, t, payload)
 }
 
-func (c *AuthSocketClient) listenForMessages(ctx context.Context) {
+func (c *AuthSocketClient) listenForMessages(ctx context.Context, t transport.Transport, session *Session) {
+	for _, data := range session.Buffered() {
+		c.dispatch(ctx, session, data)
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			data, err := c.transport.Receive(ctx)
+			data, err := t.Receive(ctx)
 			if err != nil {
-				// Handle error
-				continue
+				// The connection is gone, unless the listener was stopped
+				if ctx.Err() == nil {
+					closeTransport(t)
+					c.connMutex.Lock()
+					if c.transport == t {
+						c.handshaked = false
+					}
+					c.connMutex.Unlock()
+					c.reportDisconnect(err)
+				}
+				return
 			}
-
-			var msg wire.AuthMessage
-			if err := json.Unmarshal(data, &msg); err != nil {
-				continue
+			switch messageType(data) {
+			case message.TypeChallenge:
+				c.answerChallenge(ctx, t, session, data)
+			case message.TypeError:
+				if am, err := decodeMessage(data); err == nil {
+					c.reportError(remoteError(am))
+				}
+			default:
+				c.dispatch(ctx, session, data)
 			}
+		}
+	}
+}
 
-			if msg.Type == "general" && len(msg.Payload) > 0 {
-				payloadBytes := BytesFromIntArray(msg.Payload)
-				var eventData map[string]interface{}
-				if err := json.Unmarshal(payloadBytes, &eventData); err != nil {
-					continue
-				}
+// dispatch opens a general message and passes its event to the handlers.
+func (c *AuthSocketClient) dispatch(ctx context.Context, session *Session, data []byte) {
+	payload, err := session.Open(ctx, data)
+	if err != nil {
+		c.reportError(err)
+		return
+	}
 
-				event, ok := eventData["event"].(string)
-				if !ok {
-					continue
-				}
+	event, eventData, err := decodeEvent(payload)
+	if err != nil {
+		return
+	}
 
-				c.eventMutex.RLock()
-				handlers := c.eventHandlers[event]
-				c.eventMutex.RUnlock()
+	c.eventMutex.RLock()
+	handlers := c.eventHandlers[event]
+	c.eventMutex.RUnlock()
 
-				for _, handler := range handlers {
-					go handler(eventData["data"])
-				}
-			}
-		}
+	for _, handler := range handlers {
+		go handler(eventData)
+	}
+}
+
+// answerChallenge re-authenticates to the server over t.
+func (c *AuthSocketClient) answerChallenge(ctx context.Context, t transport.Transport, session *Session, data []byte) {
+	reply, err := session.AnswerChallenge(ctx, data)
+	if err == nil {
+		err = t.Send(ctx, reply)
+	}
+	if err != nil {
+		c.reportError(fmt.Errorf("answer challenge: %w", err))
+	}
+}
+
+func (c *AuthSocketClient) reportError(err error) {
+	c.eventMutex.RLock()
+	handlers := c.errorHandlers
+	c.eventMutex.RUnlock()
+
+	for _, handler := range handlers {
+		go handler(err)
+	}
+}
+
+func (c *AuthSocketClient) reportDisconnect(err error) {
+	c.eventMutex.RLock()
+	handlers := c.disconnectHandlers
+	c.eventMutex.RUnlock()
+
+	for _, handler := range handlers {
+		go handler(err)
 	}
 }
 
@@ -126,65 +245,397 @@ func (c *AuthSocketClient) listenForMessages(ctx context.Context) {
 // It wraps a transport, performs handshake, and broadcasts events.
 type AuthSocketServer struct {
 	transport    transport.Transport
-	wallet       *wire.KeyPair
+	wallet       Wallet
+	opts         []ServerOption
+	maxClients   int
+	helloTimeout time.Duration
+	lifetime     time.Duration
+	authTimeout  time.Duration
+	authorizer   Authorizer
 	handshaked   bool
 	clients      map[string]*clientSession
-	clientsMutex sync.RWMutex
+	// pending counts handshakes in progress, which hold a slot against
+	// maxClients until they finish.
+	pending            int
+	clientsMutex       sync.RWMutex
+	eventMutex         sync.RWMutex
+	eventHandlers      map[string][]func(identityKey string, data interface{})
+	errorHandlers      []func(identityKey string, err error)
+	disconnectHandlers []func(identityKey string, err error)
+	timeouts           atomic.Uint64
 }
 
 type clientSession struct {
 	transport transport.Transport
+	session   *Session
+	metadata  map[string]string
+	// responses passes challenge responses from the listener to reauthenticate.
+	responses chan []byte
+	cancel    context.CancelFunc
 }
 
-func NewAuthSocketServer(transport transport.Transport, wallet *wire.KeyPair) *AuthSocketServer {
+// NewAuthSocketServer creates a server with the given wallet. Options apply to
+// every handshake it runs; unless WithNonceStore is given, all handshakes
+// share one in-memory nonce store.
+func NewAuthSocketServer(transport transport.Transport, wallet Wallet, opts ...ServerOption) *AuthSocketServer {
+	cfg := newServerConfig(opts)
 	return &AuthSocketServer{
-		transport: transport,
-		wallet:    wallet,
-		clients:   make(map[string]*clientSession),
+		transport:     transport,
+		wallet:        wallet,
+		opts:          append([]ServerOption{WithNonceStore(NewMemoryNonceStore())}, opts...),
+		maxClients:    cfg.maxClients,
+		helloTimeout:  cfg.helloTimeout,
+		lifetime:      cfg.sessionLifetime,
+		authTimeout:   cfg.authTimeout,
+		authorizer:    cfg.authorizer,
+		clients:       make(map[string]*clientSession),
+		eventHandlers: make(map[string][]func(identityKey string, data interface{})),
 	}
 }
 
-// AcceptClient performs handshake with a new client and adds to clients.
+// AcceptClient performs handshake with a new client and adds to clients,
+// keyed by the identity key the client proved; a client already connected
+// under that key is disconnected with ErrReplaced. Messages from the client
+// are then verified and dispatched to handlers until ctx is done. If the
+// handshake fails, the client is sent an error message and the transport is
+// closed if it is an io.Closer. Handshakes that time out are counted; see
+// HandshakeTimeouts.
 func (s *AuthSocketServer) AcceptClient(ctx context.Context, clientTransport transport.Transport) error {
-	err := RunServerHandshake(ctx, clientTransport)
+	ctx, cs, err := s.accept(ctx, clientTransport)
 	if err != nil {
 		return err
 	}
+	go s.listenForMessages(ctx, cs)
+	return nil
+}
+
+// accept runs the handshake with a new client and registers it, returning
+// the context its goroutines run under, which is cancelled once the client
+// is gone. The caller runs listenForMessages.
+func (s *AuthSocketServer) accept(ctx context.Context, clientTransport transport.Transport) (context.Context, *clientSession, error) {
+	if !s.reserve() {
+		ctx, cancel := withHandshakeTimeout(ctx, clientTransport, s.helloTimeout, "no hello")
+		defer cancel()
+		return nil, nil, s.handshakeFailed(clientTransport, rejectHandshake(ctx, clientTransport, ErrServerBusy))
+	}
+	session, err := RunServerHandshake(ctx, clientTransport, s.wallet, s.opts...)
+	if err != nil {
+		s.clientsMutex.Lock()
+		s.pending--
+		s.clientsMutex.Unlock()
+		return nil, nil, s.handshakeFailed(clientTransport, err)
+	}
 
 	// Add client
+	ctx, cancel := context.WithCancel(ctx)
+	cs := &clientSession{transport: clientTransport, session: session, responses: make(chan []byte, 1), cancel: cancel}
+	if mp, ok := clientTransport.(transport.MetadataProvider); ok {
+		cs.metadata = mp.Metadata()
+	}
 	s.clientsMutex.Lock()
-	s.clients["client-id"] = &clientSession{transport: clientTransport} // Use actual ID
+	s.pending--
+	previous := s.clients[session.PeerIdentityKey]
+	s.clients[session.PeerIdentityKey] = cs
 	s.clientsMutex.Unlock()
+	if previous != nil {
+		previous.cancel()
+		closeTransport(previous.transport)
+		s.reportDisconnect(session.PeerIdentityKey, ErrReplaced)
+	}
 
-	return nil
+	if s.lifetime > 0 {
+		go s.reauthenticate(ctx, cs)
+	}
+	return ctx, cs, nil
 }
 
-// Emit broadcasts an event to all connected clients.
-func (s *AuthSocketServer) Emit(ctx context.Context, event string, data interface{}) error {
-	msg := wire.AuthMessage{
-		Version: "1",
-		Type:    "general",
-		Payload: []int{},
+// handshakeFailed closes the transport of a client whose handshake failed
+// with err, counting timeouts, and returns err.
+func (s *AuthSocketServer) handshakeFailed(t transport.Transport, err error) error {
+	if errors.Is(err, ErrHandshakeTimeout) {
+		s.timeouts.Add(1)
+	}
+	closeTransport(t)
+	return err
+}
+
+// HandshakeTimeouts returns how many client handshakes have failed with
+// ErrHandshakeTimeout since the server was created.
+func (s *AuthSocketServer) HandshakeTimeouts() uint64 {
+	return s.timeouts.Load()
+}
+
+// reserve takes a slot for a new handshake, counting connected clients and
+// handshakes in progress against maxClients, and reports whether one was
+// free.
+func (s *AuthSocketServer) reserve() bool {
+	s.clientsMutex.Lock()
+	defer s.clientsMutex.Unlock()
+	if s.maxClients > 0 && len(s.clients)+s.pending >= s.maxClients {
+		return false
 	}
-	payloadData, err := json.Marshal(map[string]interface{}{"event": event, "data": data})
+	s.pending++
+	return true
+}
+
+func closeTransport(t transport.Transport) {
+	if c, ok := t.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// Session returns the session of the connected client with the given identity
+// key, including any certificates it presented during the handshake.
+func (s *AuthSocketServer) Session(identityKey string) (*Session, bool) {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+	cs, ok := s.clients[identityKey]
+	if !ok {
+		return nil, false
+	}
+	return cs.session, true
+}
+
+// On registers a handler for an event sent by any authenticated client.
+// The handler receives the sender's identity key.
+func (s *AuthSocketServer) On(event string, handler func(identityKey string, data interface{})) {
+	s.eventMutex.Lock()
+	defer s.eventMutex.Unlock()
+	s.eventHandlers[event] = append(s.eventHandlers[event], handler)
+}
+
+// OnError registers a handler for client messages that were dropped, such as
+// ones whose signature does not verify against the client's identity, and for
+// clients disconnected by the server, such as failed handshakes on Handler.
+func (s *AuthSocketServer) OnError(handler func(identityKey string, err error)) {
+	s.eventMutex.Lock()
+	defer s.eventMutex.Unlock()
+	s.errorHandlers = append(s.errorHandlers, handler)
+}
+
+// OnDisconnect registers a handler for clients that are gone: their
+// connection failed, they stopped answering keepalive pings (see
+// transport.ErrPeerDead), or their session expired. The client has been
+// removed and its transport closed by then. Clients dropped because the
+// context given to AcceptClient is done are not reported.
+func (s *AuthSocketServer) OnDisconnect(handler func(identityKey string, err error)) {
+	s.eventMutex.Lock()
+	defer s.eventMutex.Unlock()
+	s.disconnectHandlers = append(s.disconnectHandlers, handler)
+}
+
+// Emit broadcasts an event to all connected clients, signed under each
+// client's session. The sends run concurrently; Emit waits for them and
+// returns the errors of any that failed.
+func (s *AuthSocketServer) Emit(ctx context.Context, event string, data interface{}) error {
+	payload, err := encodeEvent(event, data)
 	if err != nil {
 		return err
 	}
-	msg.Payload = IntsFromBytes(payloadData)
 
-	raw, err := json.Marshal(msg)
+	s.clientsMutex.RLock()
+	clients := make([]*clientSession, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.clientsMutex.RUnlock()
+
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.session.send(ctx, client.transport, payload); err != nil {
+				errs[i] = fmt.Errorf("emit to %s: %w", client.session.PeerIdentityKey, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *AuthSocketServer) listenForMessages(ctx context.Context, cs *clientSession) {
+	for _, data := range cs.session.Buffered() {
+		s.dispatch(ctx, cs, data)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			data, err := cs.transport.Receive(ctx)
+			if err != nil {
+				// The connection is gone, unless the server is stopping;
+				// forget the client
+				stopping := ctx.Err() != nil
+				cs.cancel()
+				s.removeClient(cs)
+				if !stopping {
+					closeTransport(cs.transport)
+					s.reportDisconnect(cs.session.PeerIdentityKey, err)
+				}
+				return
+			}
+			if messageType(data) == message.TypeChallengeResponse {
+				select {
+				case cs.responses <- data:
+				default:
+				}
+				continue
+			}
+			s.dispatch(ctx, cs, data)
+		}
+	}
+}
+
+// dispatch opens a general message from cs and passes its event to the
+// handlers.
+func (s *AuthSocketServer) dispatch(ctx context.Context, cs *clientSession, data []byte) {
+	identityKey := cs.session.PeerIdentityKey
+	payload, err := cs.session.Open(ctx, data)
+	if err != nil {
+		s.reportError(identityKey, err)
+		return
+	}
+
+	event, eventData, err := decodeEvent(payload)
+	if err != nil {
+		return
+	}
+
+	s.eventMutex.RLock()
+	handlers := s.eventHandlers[event]
+	s.eventMutex.RUnlock()
+
+	for _, handler := range handlers {
+		go handler(identityKey, eventData)
+	}
+}
+
+// reauthenticate challenges the client whenever its session reaches the
+// configured lifetime, until ctx is done or the client fails to answer.
+func (s *AuthSocketServer) reauthenticate(ctx context.Context, cs *clientSession) {
+	for {
+		timer := time.NewTimer(time.Until(cs.session.AuthenticatedAt().Add(s.lifetime)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := s.challenge(ctx, cs); err != nil {
+			if ctx.Err() == nil {
+				s.expire(cs, err)
+			}
+			return
+		}
+	}
+}
+
+// challenge asks the client to prove its identity again and consults the
+// Authorizer about it.
+func (s *AuthSocketServer) challenge(ctx context.Context, cs *clientSession) error {
+	challenge, err := cs.session.Challenge(ctx)
 	if err != nil {
 		return err
 	}
+	if err := cs.transport.Send(ctx, challenge); err != nil {
+		return err
+	}
+	timeout := s.authTimeout
+	if timeout <= 0 {
+		timeout = DefaultAuthTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return fmt.Errorf("challenge not answered within %s", timeout)
+		case raw := <-cs.responses:
+			err := cs.session.VerifyChallengeResponse(ctx, raw)
+			if errors.Is(err, ErrNonceMismatch) {
+				// An answer to an earlier challenge.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if s.authorizer == nil {
+				return nil
+			}
+			claims, err := authorize(ctx, s.authorizer, AuthorizationRequest{
+				IdentityKey:  cs.session.PeerIdentityKey,
+				Certificates: cs.session.Certificates,
+				Metadata:     cs.metadata,
+			})
+			if err != nil {
+				return err
+			}
+			cs.session.setClaims(claims)
+			return nil
+		}
+	}
+}
 
-	s.clientsMutex.RLock()
-	defer s.clientsMutex.RUnlock()
+// expire disconnects a client whose session could not be renewed, telling it
+// why, and reports the failure through OnError.
+func (s *AuthSocketServer) expire(cs *clientSession, cause error) {
+	err := fmt.Errorf("%w: %w", ErrSessionExpired, cause)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	sendError(ctx, cs.transport, err)
+	cancel()
+	cs.cancel()
+	s.removeClient(cs)
+	closeTransport(cs.transport)
+	s.reportError(cs.session.PeerIdentityKey, err)
+	s.reportDisconnect(cs.session.PeerIdentityKey, err)
+}
 
-	for _, client := range s.clients {
-		go client.transport.Send(ctx, raw)
+func (s *AuthSocketServer) removeClient(cs *clientSession) {
+	s.clientsMutex.Lock()
+	defer s.clientsMutex.Unlock()
+	if s.clients[cs.session.PeerIdentityKey] == cs {
+		delete(s.clients, cs.session.PeerIdentityKey)
 	}
+}
 
-	return nil
+func (s *AuthSocketServer) reportError(identityKey string, err error) {
+	s.eventMutex.RLock()
+	handlers := s.errorHandlers
+	s.eventMutex.RUnlock()
+
+	for _, handler := range handlers {
+		go handler(identityKey, err)
+	}
+}
+
+func (s *AuthSocketServer) reportDisconnect(identityKey string, err error) {
+	s.eventMutex.RLock()
+	handlers := s.disconnectHandlers
+	s.eventMutex.RUnlock()
+
+	for _, handler := range handlers {
+		go handler(identityKey, err)
+	}
 }
 
-var ErrNotConnected = errors.New("not connected")
+// encodeEvent encodes an event and its data as the JSON payload of a general message.
+func encodeEvent(event string, data interface{}) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"event": event, "data": data})
+}
+
+func decodeEvent(payload []byte) (string, interface{}, error) {
+	var eventData map[string]interface{}
+	if err := json.Unmarshal(payload, &eventData); err != nil {
+		return "", nil, err
+	}
+	event, ok := eventData["event"].(string)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: payload missing event name", ErrMalformedMessage)
+	}
+	return event, eventData["data"], nil
+}
@@ -2,16 +2,17 @@ package authsocket
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
 	"github.com/sirdeggen/go-authsocket/authsocket/transport"
-	"github.com/sirdeggen/go-authsocket/internal/wire"
 )
 
 func TestAuthSocketClientServer(t *testing.T) {
 	hexpriv := "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
-	wallet, err := wire.NewKeyPairFromHex(hexpriv)
+	wallet, err := identity.FromHex(hexpriv)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -19,11 +20,26 @@ func TestAuthSocketClientServer(t *testing.T) {
 	clientTransport, serverTransport := transport.InMemoryPair()
 
 	client := NewAuthSocketClient(clientTransport, wallet)
-	server := NewAuthSocketServer(serverTransport, wallet) // Server wallet not used in this test
+	serverWallet := demoKeypair()
+	server := NewAuthSocketServer(serverTransport, serverWallet)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	serverGot := make(chan string, 1)
+	server.On("test-event", func(identityKey string, data interface{}) {
+		if identityKey != wallet.PubHex() {
+			t.Errorf("server handler got identity %s, want %s", identityKey, wallet.PubHex())
+		}
+		s, _ := data.(string)
+		serverGot <- s
+	})
+	clientGot := make(chan float64, 1)
+	client.On("server-event", func(data interface{}) {
+		n, _ := data.(float64)
+		clientGot <- n
+	})
+
 	// Start server accepting in background
 	go func() {
 		err := server.AcceptClient(ctx, serverTransport)
@@ -37,21 +53,96 @@ func TestAuthSocketClientServer(t *testing.T) {
 	if err != nil {
 		t.Fatal("client connect:", err)
 	}
+	if client.ServerIdentityKey() != serverWallet.PubHex() {
+		t.Fatalf("client authenticated server %s, want %s", client.ServerIdentityKey(), serverWallet.PubHex())
+	}
 
 	// Test emit from client
 	err = client.Emit(ctx, "test-event", "hello world")
 	if err != nil {
 		t.Fatal("client emit:", err)
 	}
-
-	// Wait a bit for message to propagate
-	time.Sleep(100 * time.Millisecond)
+	select {
+	case got := <-serverGot:
+		if got != "hello world" {
+			t.Fatalf("server received %q", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("server did not receive client event")
+	}
 
 	// Test emit from server
 	err = server.Emit(ctx, "server-event", 42)
 	if err != nil {
 		t.Fatal("server emit:", err)
 	}
+	select {
+	case got := <-clientGot:
+		if got != 42 {
+			t.Fatalf("client received %v", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("client did not receive server event")
+	}
 
 	t.Log("AuthSocket client-server test completed")
-}
\ No newline at end of file
+}
+
+func TestAcceptClientReplacesIdentity(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair())
+	gone := make(chan error, 2)
+	server.OnDisconnect(func(identityKey string, err error) { gone <- err })
+	connect := func() *AuthSocketClient {
+		t.Helper()
+		clientT, serverT := transport.InMemoryPair()
+		go server.AcceptClient(ctx, serverT)
+		client := NewAuthSocketClient(clientT, wallet)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	first := connect()
+	firstGot := make(chan interface{}, 1)
+	first.On("ping", func(data interface{}) { firstGot <- data })
+	second := connect()
+	secondGot := make(chan interface{}, 1)
+	second.On("ping", func(data interface{}) { secondGot <- data })
+
+	// The first connection is dropped in favour of the second.
+	select {
+	case err := <-gone:
+		if !errors.Is(err, ErrReplaced) {
+			t.Fatalf("expected ErrReplaced, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("replaced connection was not reported")
+	}
+	_, secondSession, _ := second.conn()
+	if session, ok := server.Session(wallet.PubHex()); !ok || session.ID != secondSession.ID {
+		t.Fatal("identity is not registered to the newer connection")
+	}
+	if err := server.Emit(ctx, "ping", "to the newer connection"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-secondGot:
+	case <-ctx.Done():
+		t.Fatal("newer connection did not receive the event")
+	}
+	select {
+	case data := <-firstGot:
+		t.Fatalf("replaced connection received %v", data)
+	case err := <-gone:
+		t.Fatalf("unexpected second disconnect: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,161 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/bsv-blockchain/go-sdk/auth/certificates"
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/wallet"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+)
+
+// CertificateRequest is sent by the server with its nonce: the certifier
+// identity keys it trusts (compressed hex) and, per base64 certificate type,
+// the fields the client must reveal.
+type CertificateRequest = message.RequestedCertificates
+
+// Certificate is an identity certificate a client presented during the
+// handshake, after its subject, certifier signature and requested type have
+// been checked and its revealed fields decrypted.
+type Certificate struct {
+	// Type is the base64 certificate type.
+	Type string
+	// SerialNumber is the base64 serial number.
+	SerialNumber string
+	// Certifier is the certifier's compressed identity key in hex.
+	Certifier string
+	// Fields holds the plaintext of every field revealed to the server.
+	Fields map[string]string
+}
+
+// CertificateProvider returns the certificates a client presents in answer to
+// req. Keyrings must be created for verifierIdentityKey, the server identity
+// proven in the nonce message.
+type CertificateProvider func(ctx context.Context, req *CertificateRequest, verifierIdentityKey string) ([]*certificates.VerifiableCertificate, error)
+
+// staticCertificates is the CertificateProvider behind WithCertificates: it
+// presents every certificate whose certifier and type were requested.
+func staticCertificates(certs []*certificates.VerifiableCertificate) CertificateProvider {
+	return func(_ context.Context, req *CertificateRequest, _ string) ([]*certificates.VerifiableCertificate, error) {
+		var out []*certificates.VerifiableCertificate
+		for _, cert := range certs {
+			if certifierRequested(req, &cert.Certifier) && typeRequested(req, string(cert.Type)) {
+				out = append(out, cert)
+			}
+		}
+		return out, nil
+	}
+}
+
+func certifierRequested(req *CertificateRequest, certifier *ec.PublicKey) bool {
+	if len(req.Certifiers) == 0 {
+		return true
+	}
+	if certifier.X == nil {
+		return false
+	}
+	key := hex.EncodeToString(certifier.Compressed())
+	for _, c := range req.Certifiers {
+		if strings.ToLower(c) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func typeRequested(req *CertificateRequest, certType string) bool {
+	if len(req.Types) == 0 {
+		return true
+	}
+	_, ok := req.Types[certType]
+	return ok
+}
+
+// verifyCertificates checks the certificates a client presented against req
+// and returns them with their revealed fields decrypted by verifier. Every
+// requested type must be covered and every requested field revealed.
+func verifyCertificates(ctx context.Context, verifier wallet.CipherOperations, req *CertificateRequest, subject string, certs []*certificates.VerifiableCertificate) ([]Certificate, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w: no certificates presented", ErrInvalidCertificate)
+	}
+	seen := make(map[string]bool)
+	out := make([]Certificate, 0, len(certs))
+	for _, cert := range certs {
+		if cert.Subject.X == nil || hex.EncodeToString(cert.Subject.Compressed()) != strings.ToLower(subject) {
+			return nil, fmt.Errorf("%w: certificate %s subject is not the client", ErrInvalidCertificate, cert.SerialNumber)
+		}
+		if !certifierRequested(req, &cert.Certifier) {
+			return nil, fmt.Errorf("%w: certificate %s has an unrequested certifier", ErrInvalidCertificate, cert.SerialNumber)
+		}
+		if !typeRequested(req, string(cert.Type)) {
+			return nil, fmt.Errorf("%w: certificate type %s was not requested", ErrInvalidCertificate, cert.Type)
+		}
+		if err := cert.Verify(ctx); err != nil {
+			return nil, fmt.Errorf("%w: certificate %s: %w", ErrInvalidCertificate, cert.SerialNumber, err)
+		}
+		fields, err := decryptCertificateFields(ctx, verifier, cert)
+		if err != nil {
+			return nil, fmt.Errorf("%w: certificate %s: %w", ErrInvalidCertificate, cert.SerialNumber, err)
+		}
+		for _, name := range req.Types[string(cert.Type)] {
+			if _, ok := fields[name]; !ok {
+				return nil, fmt.Errorf("%w: certificate %s does not reveal field %s", ErrInvalidCertificate, cert.SerialNumber, name)
+			}
+		}
+		seen[string(cert.Type)] = true
+		out = append(out, Certificate{
+			Type:         string(cert.Type),
+			SerialNumber: string(cert.SerialNumber),
+			Certifier:    hex.EncodeToString(cert.Certifier.Compressed()),
+			Fields:       fields,
+		})
+	}
+	for certType := range req.Types {
+		if !seen[certType] {
+			return nil, fmt.Errorf("%w: no certificate of type %s", ErrInvalidCertificate, certType)
+		}
+	}
+	return out, nil
+}
+
+// decryptCertificateFields decrypts the fields whose revelation keys the
+// subject encrypted for the verifier in the certificate's keyring.
+func decryptCertificateFields(ctx context.Context, verifier wallet.CipherOperations, cert *certificates.VerifiableCertificate) (map[string]string, error) {
+	fields := make(map[string]string, len(cert.Keyring))
+	for name, encryptedKey := range cert.Keyring {
+		keyBytes, err := base64.StdEncoding.DecodeString(string(encryptedKey))
+		if err != nil {
+			return nil, fmt.Errorf("decode keyring entry %s: %w", name, err)
+		}
+		protocolID, keyID := certificates.GetCertificateEncryptionDetails(string(name), string(cert.SerialNumber))
+		key, err := verifier.Decrypt(ctx, wallet.DecryptArgs{
+			EncryptionArgs: wallet.EncryptionArgs{
+				ProtocolID:   protocolID,
+				KeyID:        keyID,
+				Counterparty: wallet.Counterparty{Type: wallet.CounterpartyTypeOther, Counterparty: &cert.Subject},
+			},
+			Ciphertext: keyBytes,
+		}, "")
+		if err != nil {
+			return nil, fmt.Errorf("decrypt revelation key for %s: %w", name, err)
+		}
+		encryptedValue, ok := cert.Fields[name]
+		if !ok {
+			return nil, fmt.Errorf("keyring reveals unknown field %s", name)
+		}
+		valueBytes, err := base64.StdEncoding.DecodeString(string(encryptedValue))
+		if err != nil {
+			return nil, fmt.Errorf("decode field %s: %w", name, err)
+		}
+		plain, err := ec.NewSymmetricKey(key.Plaintext).Decrypt(valueBytes)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt field %s: %w", name, err)
+		}
+		fields[string(name)] = string(plain)
+	}
+	return fields, nil
+}
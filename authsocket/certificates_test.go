@@ -0,0 +1,123 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/auth/certificates"
+	"github.com/bsv-blockchain/go-sdk/wallet"
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+)
+
+var kycType = base64.StdEncoding.EncodeToString([]byte("authsocket kyc certificate v1..."))
+
+// issueCertificate has certifier issue a KYC certificate to subject and
+// reveals the name field to verifier.
+func issueCertificate(t *testing.T, certifier, subject, verifier *identity.KeyPair) *certificates.VerifiableCertificate {
+	t.Helper()
+	ctx := context.Background()
+	certifierWallet, err := certifier.ProtoWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subjectWallet, err := subject.ProtoWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	master, err := certificates.IssueCertificateForSubject(ctx, certifierWallet,
+		wallet.Counterparty{Type: wallet.CounterpartyTypeOther, Counterparty: subject.Pub},
+		map[string]string{"name": "Alice", "country": "NZ"}, kycType, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := certificates.CreateKeyringForVerifier(ctx, subjectWallet,
+		wallet.Counterparty{Type: wallet.CounterpartyTypeOther, Counterparty: certifier.Pub},
+		wallet.Counterparty{Type: wallet.CounterpartyTypeOther, Counterparty: verifier.Pub},
+		master.Fields, []wallet.CertificateFieldNameUnder50Bytes{"name"}, master.MasterKeyring,
+		master.SerialNumber, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificates.NewVerifiableCertificate(&master.Certificate, keyring)
+}
+
+func TestHandshakeWithRequestedCertificates(t *testing.T) {
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certifier, err := identity.FromHex("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := issueCertificate(t, certifier, clientKey, demoKeypair())
+	req := CertificateRequest{
+		Certifiers: []string{certifier.PubHex()},
+		Types:      map[string][]string{kycType: {"name"}},
+	}
+
+	_, session, _, err := runHandshakePair(t, nil, []ClientOption{WithCertificates(cert)}, []ServerOption{WithRequestedCertificates(req)})
+	if err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	if len(session.Certificates) != 1 {
+		t.Fatalf("expected 1 certificate, got %d", len(session.Certificates))
+	}
+	got := session.Certificates[0]
+	if got.Certifier != certifier.PubHex() || got.Type != kycType {
+		t.Fatalf("unexpected certificate %+v", got)
+	}
+	if got.Fields["name"] != "Alice" {
+		t.Fatalf("expected decrypted name Alice, got %q", got.Fields["name"])
+	}
+	if _, revealed := got.Fields["country"]; revealed {
+		t.Fatal("country was not revealed to the server but was decrypted")
+	}
+}
+
+func TestHandshakeRejectsMissingCertificates(t *testing.T) {
+	certifier, err := identity.FromHex("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := CertificateRequest{
+		Certifiers: []string{certifier.PubHex()},
+		Types:      map[string][]string{kycType: {"name"}},
+	}
+
+	if _, _, _, err := runHandshakePair(t, nil, nil, []ServerOption{WithRequestedCertificates(req)}); !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("expected ErrInvalidCertificate, got %v", err)
+	}
+}
+
+func TestHandshakeRejectsUntrustedCertifier(t *testing.T) {
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := identity.FromHex("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, err := identity.FromHex("030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := issueCertificate(t, untrusted, clientKey, demoKeypair())
+	req := CertificateRequest{
+		Certifiers: []string{trusted.PubHex()},
+		Types:      map[string][]string{kycType: {"name"}},
+	}
+
+	// A provider that ignores the request still cannot get the certificate accepted
+	provider := func(context.Context, *CertificateRequest, string) ([]*certificates.VerifiableCertificate, error) {
+		return []*certificates.VerifiableCertificate{cert}, nil
+	}
+	_, _, _, err = runHandshakePair(t, nil, []ClientOption{WithCertificateProvider(provider)}, []ServerOption{WithRequestedCertificates(req)})
+	if !errors.Is(err, ErrInvalidCertificate) {
+		t.Fatalf("expected ErrInvalidCertificate, got %v", err)
+	}
+}
@@ -1,38 +1,197 @@
 package authsocket
 
 import (
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 
+	"github.com/bsv-blockchain/go-sdk/auth/certificates"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
 	"github.com/sirdeggen/go-authsocket/internal/wire"
 )
 
 // Client scaffolding for in-process handshake with above server
-type Client struct{ Wallet *wire.KeyPair }
+type Client struct {
+	Wallet Wallet
+	// TrustedServerKeys, when non-empty, pins the server to one of these identity keys.
+	TrustedServerKeys []string
+	// Certificates answers a server's certificate request; when nil, no
+	// certificates are presented.
+	Certificates CertificateProvider
+	// Versions lists the protocol versions offered in the hello, most
+	// preferred first; when empty, SupportedVersions is offered.
+	Versions []string
+	// Features lists optional features offered in the hello.
+	Features []string
+	// Origin is the origin or URL of the server being connected to, covered
+	// by both handshake signatures. It must match the server's Origin.
+	Origin string
+	// ServerIdentityKey is set once HandleNonce has verified the server's signature.
+	ServerIdentityKey string
+	// Version and NegotiatedFeatures are set by HandleNonce to the version
+	// and features the server selected.
+	Version            string
+	NegotiatedFeatures []string
 
-func NewClient(w *wire.KeyPair) *Client { return &Client{Wallet: w} }
+	identityKey  string
+	nonce        []int
+	serverNonce  []int
+	presentCerts []*certificates.VerifiableCertificate
+}
+
+func NewClient(w Wallet) *Client { return &Client{Wallet: w} }
 
-func (c *Client) Hello() ([]byte, error) {
-	pubHex := hex.EncodeToString(c.Wallet.PubKey())
-	am := wire.AuthMessage{Version: "1", Type: "hello", IdentityKey: pubHex}
+// Hello returns the opening message, carrying the wallet's identity key and
+// a fresh client nonce that the server must echo and sign.
+func (c *Client) Hello(ctx context.Context) ([]byte, error) {
+	key, err := identityKey(ctx, c.Wallet)
+	if err != nil {
+		return nil, err
+	}
+	c.identityKey = key
+	c.nonce = wire.MakeNonceIntArray()
+	versions := c.versions()
+	am := message.AuthMessage{
+		Version:           versions[0],
+		Type:              message.TypeHello,
+		IdentityKey:       c.identityKey,
+		Nonce:             c.nonce,
+		SupportedVersions: versions,
+		Features:          c.Features,
+	}
 	return json.Marshal(am)
 }
 
-func (c *Client) Auth(nonce []int) ([]byte, error) {
-	nonceBytes := make([]byte, len(nonce))
-	for i, v := range nonce {
-		nonceBytes[i] = byte(v)
+func (c *Client) versions() []string {
+	if len(c.Versions) == 0 {
+		return SupportedVersions
+	}
+	return c.Versions
+}
+
+// HandleNonce verifies that the server selected a version we offered, echoed
+// our nonce and signed the handshake preimage, records the server
+// identity, and returns the signed Auth reply, carrying certificates if the
+// server requested them. An error message from the server is returned as an
+// error.
+func (c *Client) HandleNonce(ctx context.Context, raw []byte) ([]byte, error) {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	if am.Type == message.TypeError {
+		return nil, remoteError(am)
+	}
+	if am.Type != message.TypeNonce {
+		return nil, unexpectedMessage(am.Type, message.TypeNonce)
+	}
+	if am.IdentityKey == "" {
+		return nil, fmt.Errorf("%w: nonce missing identityKey", ErrInvalidHandshake)
+	}
+	if c.nonce == nil {
+		return nil, fmt.Errorf("%w: nonce before hello", ErrInvalidHandshake)
+	}
+	if !contains(c.versions(), am.Version) {
+		return nil, fmt.Errorf("%w: server selected version %q", ErrUnsupportedVersion, am.Version)
+	}
+	if !equalInts(am.YourNonce, c.nonce) {
+		return nil, ErrNonceMismatch
+	}
+	preimage, err := wire.HandshakePreimage(wire.HandshakeParams{
+		Role:              wire.RoleServer,
+		Version:           am.Version,
+		Features:          am.Features,
+		OfferedVersions:   c.versions(),
+		OfferedFeatures:   c.Features,
+		Origin:            wire.NormalizeOrigin(c.Origin),
+		ClientNonce:       BytesFromIntArray(c.nonce),
+		ServerNonce:       BytesFromIntArray(am.Payload),
+		ClientIdentityKey: c.identityKey,
+		ServerIdentityKey: am.IdentityKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHandshake, err)
+	}
+	keyID := wire.SessionID(BytesFromIntArray(c.nonce), BytesFromIntArray(am.Payload))
+	if err := verifySignature(ctx, c.Wallet, am.IdentityKey, keyID, preimage, am.Signature); err != nil {
+		return nil, err
+	}
+	if !c.trusts(am.IdentityKey) {
+		return nil, fmt.Errorf("%w: %s", ErrServerIdentityMismatch, am.IdentityKey)
+	}
+	c.ServerIdentityKey = am.IdentityKey
+	c.Version = am.Version
+	c.NegotiatedFeatures = intersect(am.Features, c.Features)
+	if am.RequestedCertificates != nil && c.Certificates != nil {
+		certs, err := c.Certificates(ctx, am.RequestedCertificates, am.IdentityKey)
+		if err != nil {
+			return nil, fmt.Errorf("provide certificates: %w", err)
+		}
+		c.presentCerts = certs
+	}
+	return c.Auth(ctx, am.Payload)
+}
+
+// trusts reports whether identityKey satisfies the client's pinned server keys.
+func (c *Client) trusts(identityKey string) bool {
+	if len(c.TrustedServerKeys) == 0 {
+		return true
+	}
+	identityKey = strings.ToLower(identityKey)
+	for _, k := range c.TrustedServerKeys {
+		if strings.ToLower(k) == identityKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Auth signs the handshake preimage for the server. It must follow Hello;
+// HandleNonce calls it once the server is verified.
+func (c *Client) Auth(ctx context.Context, serverNonce []int) ([]byte, error) {
+	if c.nonce == nil {
+		return nil, fmt.Errorf("%w: auth before hello", ErrInvalidHandshake)
+	}
+	preimage, err := wire.HandshakePreimage(wire.HandshakeParams{
+		Role:              wire.RoleClient,
+		Version:           c.Version,
+		Features:          c.NegotiatedFeatures,
+		OfferedVersions:   c.versions(),
+		OfferedFeatures:   c.Features,
+		Origin:            wire.NormalizeOrigin(c.Origin),
+		ClientNonce:       BytesFromIntArray(c.nonce),
+		ServerNonce:       BytesFromIntArray(serverNonce),
+		ClientIdentityKey: c.identityKey,
+		ServerIdentityKey: c.ServerIdentityKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHandshake, err)
 	}
-	sig, err := c.Wallet.Sign(nonceBytes)
+	keyID := wire.SessionID(BytesFromIntArray(c.nonce), BytesFromIntArray(serverNonce))
+	sig, err := createSignature(ctx, c.Wallet, c.ServerIdentityKey, keyID, preimage)
 	if err != nil {
 		return nil, err
 	}
-	am := wire.AuthMessage{
-		Version:     "1",
-		Type:        "auth",
-		Payload:     nonce,
-		IdentityKey: hex.EncodeToString(c.Wallet.PubKey()),
-		Signature:   hex.EncodeToString(sig),
+	c.serverNonce = serverNonce
+	am := message.AuthMessage{
+		Version:     c.Version,
+		Type:        message.TypeAuth,
+		Nonce:       c.nonce,
+		Payload:     serverNonce,
+		IdentityKey: c.identityKey,
+		Signature:   sig,
+
+		Certificates: c.presentCerts,
 	}
 	return json.Marshal(am)
 }
+
+// SessionID returns the identifier shared with the server once Auth has been
+// produced, or "" before then.
+func (c *Client) SessionID() string {
+	if c.serverNonce == nil {
+		return ""
+	}
+	return wire.SessionID(BytesFromIntArray(c.nonce), BytesFromIntArray(c.serverNonce))
+}
@@ -0,0 +1,189 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+// Handshake failures. Errors returned by the handshake match one of these
+// with errors.Is, usually wrapped in a *HandshakeError and with detail added.
+var (
+	ErrInvalidHandshake   = errors.New("invalid handshake")
+	ErrMalformedMessage   = errors.New("malformed message")
+	ErrUnexpectedMessage  = errors.New("unexpected message type")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrNonceMismatch      = errors.New("nonce does not match the issued nonce")
+	ErrIdentityMismatch   = errors.New("identity key does not match hello")
+	ErrNonceUnknown       = errors.New("nonce was not issued, has expired or was already used")
+	ErrInvalidCertificate = errors.New("invalid certificate")
+	ErrUnauthorized       = errors.New("client is not authorized")
+	ErrUnsupportedVersion = errors.New("no mutually supported protocol version")
+	ErrServerBusy         = errors.New("server is at capacity")
+	ErrWallet             = errors.New("wallet operation failed")
+	ErrHandshakeTimeout   = errors.New("handshake timed out")
+	ErrResumeRejected     = errors.New("session cannot be resumed")
+
+	ErrServerIdentityMismatch = errors.New("server identity is not one of the pinned keys")
+)
+
+// Session failures, reported for messages dropped after the handshake.
+var (
+	ErrReplayedMessage    = errors.New("message sequence number was already received")
+	ErrMessageOutOfWindow = errors.New("message sequence number is outside the replay window")
+	ErrDecryption         = errors.New("message payload could not be decrypted")
+	ErrNotConnected       = errors.New("not connected")
+	ErrSessionExpired     = errors.New("session expired without re-authentication")
+	ErrReplaced           = errors.New("connection replaced by a newer one from the same identity")
+)
+
+// Handshake stages and operations, reported in HandshakeError.
+const (
+	StageHello = "hello"
+	StageNonce = "nonce"
+	StageAuth  = "auth"
+	StageOK    = "ok"
+	// StageResume is the resume message and its resumed reply.
+	StageResume = "resume"
+
+	OpSend    = "send"
+	OpReceive = "receive"
+	OpProcess = "process"
+)
+
+// HandshakeError describes a failed handshake: the message (Stage) being
+// sent, received or processed (Op) when it failed, the identity key the peer
+// claimed if known by then, and the cause.
+type HandshakeError struct {
+	Stage        string
+	Op           string
+	PeerIdentity string
+	Err          error
+}
+
+func (e *HandshakeError) Error() string {
+	msg := e.Op + " " + e.Stage
+	if e.PeerIdentity != "" {
+		msg += " (peer " + e.PeerIdentity + ")"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *HandshakeError) Unwrap() error { return e.Err }
+
+// RemoteError is a handshake failure reported by the peer in an error
+// message. It unwraps to the sentinel matching its code, such as
+// ErrUnauthorized for "unauthorized", so both errors.As and errors.Is work.
+type RemoteError struct {
+	// Code is one of the message.Code constants.
+	Code string
+	// Reason is a human-readable explanation from the peer.
+	Reason string
+	// Retryable reports whether the peer expects a later attempt to succeed.
+	Retryable bool
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("peer rejected handshake: %s: %s", e.Code, e.Reason)
+}
+
+func (e *RemoteError) Unwrap() error {
+	for _, c := range errorCodes {
+		if c.code == e.Code {
+			return c.err
+		}
+	}
+	return ErrInvalidHandshake
+}
+
+// errorCodes maps handshake failures to the codes reported to the peer. The
+// first sentinel an error matches decides its code.
+var errorCodes = []struct {
+	err       error
+	code      string
+	retryable bool
+}{
+	{ErrUnsupportedVersion, message.CodeUnsupportedVersion, false},
+	{ErrInvalidSignature, message.CodeBadSignature, false},
+	{ErrUnauthorized, message.CodeUnauthorized, false},
+	{ErrServerBusy, message.CodeServerBusy, true},
+	{ErrHandshakeTimeout, message.CodeHandshakeTimeout, true},
+	{ErrResumeRejected, message.CodeResumeRejected, false},
+	{ErrSessionExpired, message.CodeSessionExpired, true},
+	{ErrNonceUnknown, message.CodeNonceExpired, true},
+	{ErrInvalidCertificate, message.CodeInvalidCertificate, false},
+	{ErrInvalidHandshake, message.CodeInvalidHandshake, false},
+	{ErrMalformedMessage, message.CodeInvalidHandshake, false},
+	{ErrUnexpectedMessage, message.CodeInvalidHandshake, false},
+	{ErrNonceMismatch, message.CodeInvalidHandshake, false},
+	{ErrIdentityMismatch, message.CodeInvalidHandshake, false},
+	{ErrServerIdentityMismatch, message.CodeInvalidHandshake, false},
+}
+
+// ErrorCode returns the message.Code constant classifying err, as reported
+// to the peer, for bucketing failures in logs and metrics. Errors received
+// from the peer keep their code; unclassified errors, including wallet,
+// nonce store and transport failures, are message.CodeInternal.
+func ErrorCode(err error) string {
+	var re *RemoteError
+	if errors.As(err, &re) {
+		return re.Code
+	}
+	code, _ := classify(err)
+	return code
+}
+
+func classify(err error) (code string, retryable bool) {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code, c.retryable
+		}
+	}
+	return message.CodeInternal, true
+}
+
+// errorMessage returns the wire error message telling the peer why its
+// handshake failed. Internal errors are reported without detail.
+func errorMessage(err error) []byte {
+	am := message.AuthMessage{
+		Version: SupportedVersions[0],
+		Type:    message.TypeError,
+		Reason:  err.Error(),
+	}
+	am.Code, am.Retryable = classify(err)
+	if am.Code == message.CodeInternal {
+		am.Reason = "internal error"
+	}
+	raw, _ := json.Marshal(am)
+	return raw
+}
+
+// errorReply returns the wire error message for err, or nil when err was
+// itself reported by the peer and must not be echoed back.
+func errorReply(err error) []byte {
+	var re *RemoteError
+	if errors.As(err, &re) {
+		return nil
+	}
+	return errorMessage(err)
+}
+
+// sendError sends the wire error message for err, unless err was itself
+// reported by the peer or the context is done. Delivery is best effort: the
+// handshake has already failed.
+func sendError(ctx context.Context, t transport.Transport, err error) {
+	reply := errorReply(err)
+	if reply == nil || ctx.Err() != nil {
+		return
+	}
+	_ = t.Send(ctx, reply)
+}
+
+// remoteError converts an error message received from the peer into an error.
+func remoteError(am *message.AuthMessage) error {
+	return &RemoteError{Code: am.Code, Reason: am.Reason, Retryable: am.Retryable}
+}
@@ -0,0 +1,239 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/wallet"
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+func TestErrorMessageCodes(t *testing.T) {
+	cases := []struct {
+		err       error
+		code      string
+		retryable bool
+	}{
+		{fmt.Errorf("%w: bad der", ErrInvalidSignature), message.CodeBadSignature, false},
+		{fmt.Errorf("%w: identity is banned", ErrUnauthorized), message.CodeUnauthorized, false},
+		{ErrUnsupportedVersion, message.CodeUnsupportedVersion, false},
+		{ErrServerBusy, message.CodeServerBusy, true},
+		{ErrNonceUnknown, message.CodeNonceExpired, true},
+		{errors.New("wallet service unreachable at 10.0.0.1"), message.CodeInternal, true},
+	}
+	for _, c := range cases {
+		var am message.AuthMessage
+		if err := json.Unmarshal(errorMessage(c.err), &am); err != nil {
+			t.Fatal(err)
+		}
+		if am.Type != message.TypeError || am.Code != c.code || am.Retryable != c.retryable {
+			t.Fatalf("%v: got type %s code %s retryable %v, want error %s %v", c.err, am.Type, am.Code, am.Retryable, c.code, c.retryable)
+		}
+		if c.code == message.CodeInternal && strings.Contains(am.Reason, "10.0.0.1") {
+			t.Fatalf("internal error detail leaked to peer: %q", am.Reason)
+		}
+		var re *RemoteError
+		if err := remoteError(&am); !errors.As(err, &re) || re.Code != c.code {
+			t.Fatalf("%v: remote error %v does not carry code %s", c.err, err, c.code)
+		}
+	}
+}
+
+func TestClientSeesAuthorizerDenial(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientT, serverT := transport.InMemoryPair()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deny := WithAuthorizer(AuthorizerFunc(func(context.Context, AuthorizationRequest) (Decision, error) {
+		return Deny("identity is banned"), nil
+	}))
+	go RunServerHandshake(ctx, serverT, demoKeypair(), deny)
+
+	_, err = RunClientHandshake(ctx, clientT, wallet)
+	var re *RemoteError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected *RemoteError, got %v", err)
+	}
+	if re.Code != message.CodeUnauthorized || re.Retryable || !strings.Contains(re.Reason, "identity is banned") {
+		t.Fatalf("unexpected remote error %+v", re)
+	}
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected remote error to match ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestAcceptClientServerBusy(t *testing.T) {
+	server := NewAuthSocketServer(nil, demoKeypair(), WithMaxClients(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	connect := func(hexpriv string) (error, error) {
+		wallet, err := identity.FromHex(hexpriv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientT, serverT := transport.InMemoryPair()
+		accepted := make(chan error, 1)
+		go func() { accepted <- server.AcceptClient(ctx, serverT) }()
+		_, err = RunClientHandshake(ctx, clientT, wallet)
+		return err, <-accepted
+	}
+
+	if clientErr, acceptErr := connect("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"); clientErr != nil || acceptErr != nil {
+		t.Fatalf("first client: client %v, server %v", clientErr, acceptErr)
+	}
+	clientErr, acceptErr := connect("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if !errors.Is(acceptErr, ErrServerBusy) {
+		t.Fatalf("expected AcceptClient to fail with ErrServerBusy, got %v", acceptErr)
+	}
+	var re *RemoteError
+	if !errors.As(clientErr, &re) || re.Code != message.CodeServerBusy || !re.Retryable {
+		t.Fatalf("expected retryable server_busy, got %v", clientErr)
+	}
+}
+
+func TestAcceptClientServerBusyConcurrent(t *testing.T) {
+	// A slow Authorizer keeps every admitted handshake in progress while the
+	// others arrive.
+	slow := WithAuthorizer(AuthorizerFunc(func(context.Context, AuthorizationRequest) (Decision, error) {
+		time.Sleep(100 * time.Millisecond)
+		return Allow(nil), nil
+	}))
+	server := NewAuthSocketServer(nil, demoKeypair(), WithMaxClients(1), slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys := []string{
+		"0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20",
+		"02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021",
+		"030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122",
+	}
+	results := make(chan error, len(keys))
+	for _, hexpriv := range keys {
+		wallet, err := identity.FromHex(hexpriv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientT, serverT := transport.InMemoryPair()
+		go server.AcceptClient(ctx, serverT)
+		go func() {
+			_, err := RunClientHandshake(ctx, clientT, wallet)
+			results <- err
+		}()
+	}
+	connected, busy := 0, 0
+	for range keys {
+		err := <-results
+		switch {
+		case err == nil:
+			connected++
+		case errors.Is(err, ErrServerBusy):
+			busy++
+		default:
+			t.Fatalf("unexpected handshake error %v", err)
+		}
+	}
+	if connected != 1 || busy != len(keys)-1 {
+		t.Fatalf("connected %d and refused %d clients, want 1 and %d", connected, busy, len(keys)-1)
+	}
+}
+
+func TestHandshakeErrorStage(t *testing.T) {
+	clientT, serverT := transport.InMemoryPair()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		_, err := RunServerHandshake(ctx, serverT, demoKeypair())
+		serverErr <- err
+	}()
+	if err := clientT.Send(ctx, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := <-serverErr
+	var he *HandshakeError
+	if !errors.As(err, &he) || he.Stage != StageHello || he.Op != OpProcess {
+		t.Fatalf("expected HandshakeError at process hello, got %#v", err)
+	}
+	if !errors.Is(err, ErrMalformedMessage) || ErrorCode(err) != message.CodeInvalidHandshake {
+		t.Fatalf("expected malformed message with code invalid_handshake, got %v (%s)", err, ErrorCode(err))
+	}
+
+	raw, err := clientT.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var am message.AuthMessage
+	if err := json.Unmarshal(raw, &am); err != nil {
+		t.Fatal(err)
+	}
+	if am.Type != message.TypeError || am.Code != message.CodeInvalidHandshake {
+		t.Fatalf("client got %s %s, want error invalid_handshake", am.Type, am.Code)
+	}
+}
+
+// failingWallet is a wallet whose signing service is unreachable.
+type failingWallet struct {
+	Wallet
+}
+
+func (failingWallet) CreateSignature(context.Context, wallet.CreateSignatureArgs, string) (*wallet.CreateSignatureResult, error) {
+	return nil, errors.New("wallet service down: secret-host:9000")
+}
+
+// unverifyingWallet is a wallet that signs but cannot reach the service that
+// verifies signatures.
+type unverifyingWallet struct {
+	Wallet
+}
+
+func (unverifyingWallet) VerifySignature(context.Context, wallet.VerifySignatureArgs, string) (*wallet.VerifySignatureResult, error) {
+	return nil, errors.New("wallet service down: secret-host:9000")
+}
+
+func TestWalletFailureIsInternal(t *testing.T) {
+	clientWallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, serverWallet := range map[string]Wallet{
+		"sign":   failingWallet{demoKeypair()},
+		"verify": unverifyingWallet{demoKeypair()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clientT, serverT := transport.InMemoryPair()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				_, err := RunServerHandshake(ctx, serverT, serverWallet)
+				serverErr <- err
+			}()
+			_, err := RunClientHandshake(ctx, clientT, clientWallet)
+			if err := <-serverErr; !errors.Is(err, ErrWallet) || errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("expected server to fail with ErrWallet, got %v", err)
+			}
+			var re *RemoteError
+			if !errors.As(err, &re) || re.Code != message.CodeInternal || !re.Retryable {
+				t.Fatalf("expected retryable internal_error, got %v", err)
+			}
+			if strings.Contains(re.Reason, "secret-host") || strings.Contains(re.Reason, "wallet") {
+				t.Fatalf("wallet error detail leaked to peer: %q", re.Reason)
+			}
+		})
+	}
+}
@@ -2,99 +2,150 @@ package authsocket
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/sirdeggen/go-authsocket/authsocket/transport"
-	"github.com/sirdeggen/go-authsocket/internal/wire"
 )
 
 // RunClientHandshake drives the client side of the handshake over a transport.
-// It sends Hello, waits for Nonce, sends Auth, waits for OK.
-func RunClientHandshake(ctx context.Context, t transport.Transport, wallet *wire.KeyPair) error {
-	c := NewClient(wallet)
-
-	// 1. Send Hello
-	hello, err := c.Hello()
+// It sends Hello, waits for Nonce, verifies the server's signature, sends Auth,
+// waits for OK, and returns the session with the authenticated server identity.
+// Stray messages are skipped; see ClientHandshake.
+func RunClientHandshake(ctx context.Context, t transport.Transport, wallet Wallet, opts ...ClientOption) (*Session, error) {
+	h := NewClientHandshake(wallet, opts...)
+	hello, err := h.Start(ctx)
 	if err != nil {
-		return fmt.Errorf("hello: %w", err)
-	}
-	if err := t.Send(ctx, hello); err != nil {
-		return fmt.Errorf("send hello: %w", err)
+		return nil, err
 	}
+	return runHandshake(ctx, t, t.Receive, &h.machine, h.Handle, hello, func() string { return h.client.ServerIdentityKey })
+}
 
-	// 2. Receive Nonce
-	nonceRaw, err := t.Receive(ctx)
+// RunClientResumption continues session, from an earlier handshake with the
+// same server, over a new transport by presenting its resumption ticket. The
+// returned session is session itself, with its sequence counters intact and
+// a new ticket. Without a ticket, or if the server rejects it, a full
+// handshake is performed instead and a new session returned.
+func RunClientResumption(ctx context.Context, t transport.Transport, wallet Wallet, session *Session, opts ...ClientOption) (*Session, error) {
+	h := NewClientHandshake(wallet, opts...)
+	out, err := h.Resume(ctx, session)
 	if err != nil {
-		return fmt.Errorf("receive nonce: %w", err)
-	}
-	var nonceMsg wire.AuthMessage
-	if err := json.Unmarshal(nonceRaw, &nonceMsg); err != nil {
-		return fmt.Errorf("decode nonce: %w", err)
-	}
-	if nonceMsg.Type != "nonce" {
-		return fmt.Errorf("expected type=nonce, got %s", nonceMsg.Type)
+		return nil, err
 	}
+	return runHandshake(ctx, t, t.Receive, &h.machine, h.Handle, out, func() string { return h.client.ServerIdentityKey })
+}
 
-	// 3. Send Auth
-	auth, err := c.Auth(nonceMsg.Payload)
-	if err != nil {
-		return fmt.Errorf("auth: %w", err)
-	}
-	if err := t.Send(ctx, auth); err != nil {
-		return fmt.Errorf("send auth: %w", err)
-	}
+// Server handshake timeouts, overridden with WithHelloTimeout,
+// WithAuthTimeout and WithHandshakeTimeout.
+const (
+	DefaultHelloTimeout     = 10 * time.Second
+	DefaultAuthTimeout      = 10 * time.Second
+	DefaultHandshakeTimeout = 30 * time.Second
+)
 
-	// 4. Receive OK
-	okRaw, err := t.Receive(ctx)
-	if err != nil {
-		return fmt.Errorf("receive ok: %w", err)
-	}
-	var okMsg wire.AuthMessage
-	if err := json.Unmarshal(okRaw, &okMsg); err != nil {
-		return fmt.Errorf("decode ok: %w", err)
-	}
-	if okMsg.Type != "ok" {
-		return fmt.Errorf("expected type=ok, got %s", okMsg.Type)
-	}
+// RunServerHandshake drives the server side of the handshake over a transport.
+// It waits for Hello, sends a signed Nonce, waits for Auth, sends OK, and
+// returns the session with the authenticated client identity. Stray messages
+// are skipped; see ServerHandshake.
+//
+// The hello, auth and handshake timeouts apply whatever ctx allows. When one
+// expires the handshake fails with ErrHandshakeTimeout and t is closed if it
+// is an io.Closer, which also stops transports that ignore the context.
+func RunServerHandshake(ctx context.Context, t transport.Transport, wallet Wallet, opts ...ServerOption) (*Session, error) {
+	cfg := newServerConfig(opts)
+	h := NewServerHandshake(wallet, opts...)
+	if mp, ok := t.(transport.MetadataProvider); ok {
+		h.server.Metadata = mp.Metadata()
+	}
+	ctx, cancel := withHandshakeTimeout(ctx, t, cfg.handshakeTimeout, "handshake not completed")
+	defer cancel()
 
-	return nil
+	receive := func(ctx context.Context) ([]byte, error) {
+		d, what := cfg.helloTimeout, "no hello"
+		if h.State() == StateAwaitAuth {
+			d, what = cfg.authTimeout, "no auth"
+		}
+		ctx, cancel := withHandshakeTimeout(ctx, t, d, what)
+		defer cancel()
+		raw, err := t.Receive(ctx)
+		if err != nil {
+			return nil, handshakeTimeoutCause(ctx, err)
+		}
+		return raw, nil
+	}
+	return runHandshake(ctx, t, receive, &h.machine, h.Handle, nil, func() string { return h.server.identityKey })
 }
 
-// RunServerHandshake drives the server side of the handshake over a transport.
-// It waits for Hello, sends Nonce, waits for Auth, sends OK.
-func RunServerHandshake(ctx context.Context, t transport.Transport) error {
-	s := NewServer()
-
-	// 1. Receive Hello
-	helloRaw, err := t.Receive(ctx)
-	if err != nil {
-		return fmt.Errorf("receive hello: %w", err)
+// withHandshakeTimeout returns a context that ends after d, if d is positive,
+// with an ErrHandshakeTimeout cause, and closes t when that happens.
+func withHandshakeTimeout(ctx context.Context, t transport.Transport, d time.Duration, what string) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, d, fmt.Errorf("%w: %s within %s", ErrHandshakeTimeout, what, d))
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(context.Cause(ctx), ErrHandshakeTimeout) {
+			closeTransport(t)
+		}
+	})
+	return ctx, func() {
+		stop()
+		cancel()
 	}
+}
 
-	// 2. Process Hello -> Send Nonce
-	nonceReply, err := s.HandleHello(helloRaw)
-	if err != nil {
-		return fmt.Errorf("handle hello: %w", err)
+// handshakeTimeoutCause returns the ErrHandshakeTimeout that ended ctx in
+// place of err, the error it caused. Transports that time out by their own
+// deadline, set from ctx, may return before ctx records it.
+func handshakeTimeoutCause(ctx context.Context, err error) error {
+	if deadline, ok := ctx.Deadline(); ok && errors.Is(err, transport.ErrTimeout) && !time.Now().Before(deadline) {
+		<-ctx.Done()
 	}
-	if err := t.Send(ctx, nonceReply); err != nil {
-		return fmt.Errorf("send nonce: %w", err)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrHandshakeTimeout) {
+		return cause
 	}
+	return err
+}
 
-	// 3. Receive Auth
-	authRaw, err := t.Receive(ctx)
-	if err != nil {
-		return fmt.Errorf("receive auth: %w", err)
-	}
+// runHandshake sends out, then feeds messages from receive to handle and
+// sends its replies until the machine m is done or has failed.
+func runHandshake(ctx context.Context, t transport.Transport, receive func(context.Context) ([]byte, error), m *machine, handle func(context.Context, []byte) ([][]byte, error), out [][]byte, peer func() string) (*Session, error) {
+	for {
+		for _, raw := range out {
+			if m.state == StateFailed {
+				// The error reply is best effort: the handshake has already failed.
+				if ctx.Err() == nil {
+					_ = t.Send(ctx, raw)
+				}
+				continue
+			}
+			if err := t.Send(ctx, raw); err != nil {
+				return nil, &HandshakeError{Stage: m.sentStage(), Op: OpSend, PeerIdentity: peer(), Err: handshakeTimeoutCause(ctx, err)}
+			}
+		}
+		switch m.state {
+		case StateDone:
+			return m.session, nil
+		case StateFailed:
+			return nil, m.err
+		}
 
-	// 4. Process Auth -> Send OK
-	okReply, err := s.HandleAuth(authRaw)
-	if err != nil {
-		return fmt.Errorf("handle auth: %w", err)
-	}
-	if err := t.Send(ctx, okReply); err != nil {
-		return fmt.Errorf("send ok: %w", err)
+		raw, err := receive(ctx)
+		if err != nil {
+			return nil, &HandshakeError{Stage: m.state.stage(), Op: OpReceive, PeerIdentity: peer(), Err: err}
+		}
+		// A failure is recorded in m and returned above once out is sent.
+		out, _ = handle(ctx, raw)
 	}
+}
 
-	return nil
+// rejectHandshake answers a client's hello with the error message for err,
+// for servers that refuse a client before authenticating it.
+func rejectHandshake(ctx context.Context, t transport.Transport, err error) error {
+	if _, rerr := t.Receive(ctx); rerr != nil {
+		return &HandshakeError{Stage: StageHello, Op: OpReceive, Err: handshakeTimeoutCause(ctx, rerr)}
+	}
+	sendError(ctx, t, err)
+	return &HandshakeError{Stage: StageHello, Op: OpProcess, Err: err}
 }
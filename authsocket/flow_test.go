@@ -2,20 +2,22 @@ package authsocket
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
 	"github.com/sirdeggen/go-authsocket/authsocket/transport"
-	"github.com/sirdeggen/go-authsocket/internal/wire"
 )
 
 func TestTransportHandshake(t *testing.T) {
 	hexpriv := "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
-	wallet, err := wire.NewKeyPairFromHex(hexpriv)
+	wallet, err := identity.FromHex(hexpriv)
 	if err != nil {
 		t.Fatal(err)
 	}
+	serverWallet := demoKeypair()
 
 	clientT, serverT := transport.InMemoryPair()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -23,19 +25,20 @@ func TestTransportHandshake(t *testing.T) {
 
 	var wg sync.WaitGroup
 	var serverErr, clientErr error
+	var serverSession, clientSession *Session
 
 	// Run server in background
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		serverErr = RunServerHandshake(ctx, serverT)
+		serverSession, serverErr = RunServerHandshake(ctx, serverT, serverWallet)
 	}()
 
 	// Run client in foreground
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		clientErr = RunClientHandshake(ctx, clientT, wallet)
+		clientSession, clientErr = RunClientHandshake(ctx, clientT, wallet)
 	}()
 
 	wg.Wait()
@@ -46,13 +49,22 @@ func TestTransportHandshake(t *testing.T) {
 	if clientErr != nil {
 		t.Fatalf("client error: %v", clientErr)
 	}
+	if clientSession.PeerIdentityKey != serverWallet.PubHex() {
+		t.Fatalf("client session has server identity %s, want %s", clientSession.PeerIdentityKey, serverWallet.PubHex())
+	}
+	if serverSession.PeerIdentityKey != wallet.PubHex() {
+		t.Fatalf("server session has client identity %s, want %s", serverSession.PeerIdentityKey, wallet.PubHex())
+	}
+	if clientSession.ID == "" || clientSession.ID != serverSession.ID {
+		t.Fatalf("session IDs differ: client %q, server %q", clientSession.ID, serverSession.ID)
+	}
 
 	t.Log("transport-based handshake completed successfully: hello -> nonce -> auth -> ok")
 }
 
 func TestTransportHandshakeTimeout(t *testing.T) {
 	hexpriv := "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
-	wallet, err := wire.NewKeyPairFromHex(hexpriv)
+	wallet, err := identity.FromHex(hexpriv)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,7 +74,7 @@ func TestTransportHandshakeTimeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cancel()
 
-	err = RunClientHandshake(ctx, clientT, wallet)
+	_, err = RunClientHandshake(ctx, clientT, wallet)
 	if err == nil {
 		t.Fatal("expected timeout error, got nil")
 	}
@@ -72,7 +84,7 @@ func TestTransportHandshakeTimeout(t *testing.T) {
 func TestTransportMultipleHandshakes(t *testing.T) {
 	for i := 0; i < 5; i++ {
 		hexpriv := "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
-		wallet, err := wire.NewKeyPairFromHex(hexpriv)
+		wallet, err := identity.FromHex(hexpriv)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -86,11 +98,11 @@ func TestTransportMultipleHandshakes(t *testing.T) {
 		wg.Add(2)
 		go func() {
 			defer wg.Done()
-			serverErr = RunServerHandshake(ctx, serverT)
+			_, serverErr = RunServerHandshake(ctx, serverT, demoKeypair())
 		}()
 		go func() {
 			defer wg.Done()
-			clientErr = RunClientHandshake(ctx, clientT, wallet)
+			_, clientErr = RunClientHandshake(ctx, clientT, wallet)
 		}()
 
 		wg.Wait()
@@ -105,3 +117,55 @@ func TestTransportMultipleHandshakes(t *testing.T) {
 	}
 	t.Log("5 consecutive handshakes completed successfully")
 }
+
+func TestTransportHandshakePinnedServer(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverWallet := demoKeypair()
+	otherKey, err := identity.FromHex("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(opts ...ClientOption) error {
+		clientT, serverT := transport.InMemoryPair()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go RunServerHandshake(ctx, serverT, serverWallet)
+		_, err := RunClientHandshake(ctx, clientT, wallet, opts...)
+		return err
+	}
+
+	if err := run(WithServerIdentityKeys(otherKey.PubHex(), serverWallet.PubHex())); err != nil {
+		t.Fatalf("pinned handshake failed: %v", err)
+	}
+	if err := run(WithServerIdentityKeys(otherKey.PubHex())); !errors.Is(err, ErrServerIdentityMismatch) {
+		t.Fatalf("expected ErrServerIdentityMismatch, got %v", err)
+	}
+}
+
+func TestTransportHandshakeOrigin(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverWallet := demoKeypair()
+
+	run := func(clientOrigin string) error {
+		clientT, serverT := transport.InMemoryPair()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go RunServerHandshake(ctx, serverT, serverWallet, WithOrigin("https://example.com"))
+		_, err := RunClientHandshake(ctx, clientT, wallet, WithServerOrigin(clientOrigin))
+		return err
+	}
+
+	if err := run("wss://Example.com:443/socket"); err != nil {
+		t.Fatalf("handshake with matching origin failed: %v", err)
+	}
+	if err := run("wss://attacker.example"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for another origin, got %v", err)
+	}
+}
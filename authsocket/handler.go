@@ -0,0 +1,60 @@
+package authsocket
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+// Handler returns an http.Handler that serves each request as a client of s:
+// it upgrades the request to a WebSocket connection configured by opts, runs
+// the handshake within the server's handshake timeouts, registers the session
+// under the identity key the client proved and dispatches its messages until
+// the connection closes, after which the client is removed. Handshake
+// failures are reported through OnError, with the client's identity key if
+// it was known by then.
+//
+//	mux.Handle("/ws", server.Handler(transport.WithAllowedOrigins("https://app.example.com")))
+func (s *AuthSocketServer) Handler(opts ...transport.UpgraderOption) http.Handler {
+	upgrader := transport.NewWebSocketUpgrader(opts...)
+	return s.serveUpgraded(func(w http.ResponseWriter, r *http.Request) (transport.Transport, error) {
+		return upgrader.Upgrade(w, r)
+	})
+}
+
+// SocketIOHandler is like Handler but speaks Socket.IO over Engine.IO v4, as
+// the TypeScript authsocket-client does; see transport.SocketIOTransport. It
+// is usually mounted on "/socket.io/".
+func (s *AuthSocketServer) SocketIOHandler(opts ...transport.UpgraderOption) http.Handler {
+	upgrader := transport.NewWebSocketUpgrader(opts...)
+	return s.serveUpgraded(func(w http.ResponseWriter, r *http.Request) (transport.Transport, error) {
+		return upgrader.UpgradeSocketIO(w, r)
+	})
+}
+
+// serveUpgraded serves each connection upgrade returns as a client.
+func (s *AuthSocketServer) serveUpgraded(upgrade func(http.ResponseWriter, *http.Request) (transport.Transport, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, err := upgrade(w, r)
+		if err != nil {
+			return
+		}
+		// The request context is cancelled once the handler returns, so the
+		// connection is served here until it closes.
+		ctx, cs, err := s.accept(r.Context(), t)
+		if err != nil {
+			var he *HandshakeError
+			identityKey := ""
+			if errors.As(err, &he) {
+				identityKey = he.PeerIdentity
+			}
+			s.reportError(identityKey, err)
+			return
+		}
+		s.listenForMessages(ctx, cs)
+		cs.cancel()
+		s.removeClient(cs)
+		closeTransport(t)
+	})
+}
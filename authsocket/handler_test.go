@@ -0,0 +1,246 @@
+package authsocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+func TestAuthSocketServerHandler(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair())
+	got := make(chan string, 1)
+	server.On("greet", func(identityKey string, data interface{}) {
+		got <- identityKey
+	})
+	failures := make(chan error, 1)
+	server.OnError(func(identityKey string, err error) {
+		failures <- err
+	})
+	srv := httptest.NewServer(server.Handler())
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	clientT, err := transport.NewWebSocketClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client's listener is reading while Emit writes.
+	client := NewAuthSocketClient(clientT, wallet)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Emit(ctx, "greet", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case identityKey := <-got:
+		if identityKey != wallet.PubHex() {
+			t.Fatalf("event from %s, want %s", identityKey, wallet.PubHex())
+		}
+	case <-ctx.Done():
+		t.Fatal("server did not dispatch the event")
+	}
+	if _, ok := server.Session(wallet.PubHex()); !ok {
+		t.Fatal("client is not registered under its identity key")
+	}
+
+	// Closing the connection removes the client.
+	clientT.(*transport.WebSocketTransport).Close()
+	for {
+		if _, ok := server.Session(wallet.PubHex()); !ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("disconnected client was not removed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// A failed handshake is reported and the connection closed.
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-failures:
+		if !errors.Is(err, ErrMalformedMessage) {
+			t.Fatalf("expected ErrMalformedMessage, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("handshake failure was not reported")
+	}
+	conn.ReadMessage() // the error message
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestAuthSocketServerSocketIOHandler(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair())
+	server.On("ping", func(identityKey string, data interface{}) {
+		server.Emit(ctx, "pong", data)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/socket.io/", server.SocketIOHandler())
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	clientT, err := transport.NewSocketIOClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientT.(*transport.SocketIOTransport).Close()
+	client := NewAuthSocketClient(clientT, wallet)
+	got := make(chan interface{}, 1)
+	client.On("pong", func(data interface{}) { got <- data })
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Emit(ctx, "ping", "over socket.io"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-got:
+		if data != "over socket.io" {
+			t.Fatalf("client got %v", data)
+		}
+	case <-ctx.Done():
+		t.Fatal("no reply over socket.io")
+	}
+}
+
+func TestAuthSocketDisconnectEvents(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair())
+	serverGone := make(chan string, 1)
+	server.OnDisconnect(func(identityKey string, err error) {
+		if !errors.Is(err, transport.ErrClosed) {
+			t.Errorf("server disconnect error %v does not match ErrClosed", err)
+		}
+		serverGone <- identityKey
+	})
+	keepalive := transport.WithKeepalive(20*time.Millisecond, 30*time.Millisecond)
+	srv := httptest.NewServer(server.Handler(keepalive))
+	t.Cleanup(srv.Close)
+
+	clientT, err := transport.NewWebSocketClient("ws"+strings.TrimPrefix(srv.URL, "http"), transport.WithDialKeepalive(20*time.Millisecond, 30*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewAuthSocketClient(clientT, wallet)
+	clientGone := make(chan error, 1)
+	client.OnDisconnect(func(err error) { clientGone <- err })
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keepalive pings hold the idle connection open.
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case err := <-clientGone:
+		t.Fatalf("idle client disconnected: %v", err)
+	default:
+	}
+	if _, ok := server.Session(wallet.PubHex()); !ok {
+		t.Fatal("idle client was removed")
+	}
+
+	clientT.(*transport.WebSocketTransport).Close()
+	select {
+	case identityKey := <-serverGone:
+		if identityKey != wallet.PubHex() {
+			t.Fatalf("server reported %s gone, want %s", identityKey, wallet.PubHex())
+		}
+	case <-ctx.Done():
+		t.Fatal("server did not report the disconnect")
+	}
+	select {
+	case err := <-clientGone:
+		if !errors.Is(err, transport.ErrClosed) {
+			t.Fatalf("client disconnect error %v does not match ErrClosed", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("client did not report the disconnect")
+	}
+}
+
+func TestAuthSocketServerEmitThenCancel(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair())
+	srv := httptest.NewServer(server.Handler())
+	t.Cleanup(srv.Close)
+	clientT, err := transport.NewWebSocketClient("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientT.(*transport.WebSocketTransport).Close()
+	client := NewAuthSocketClient(clientT, wallet)
+	const n = 5
+	got := make(chan interface{}, n)
+	client.On("tick", func(data interface{}) { got <- data })
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, ok := server.Session(wallet.PubHex()); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Emit has finished sending by the time it returns, so cancelling its
+	// context straight after loses nothing.
+	for i := 0; i < n; i++ {
+		emitCtx, emitCancel := context.WithCancel(ctx)
+		if err := server.Emit(emitCtx, "tick", i); err != nil {
+			t.Fatal(err)
+		}
+		emitCancel()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case <-got:
+		case <-ctx.Done():
+			t.Fatalf("client received %d of %d events", i, n)
+		}
+	}
+}
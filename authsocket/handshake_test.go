@@ -1,24 +1,31 @@
 package authsocket
 
 import (
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
 	w "github.com/sirdeggen/go-authsocket/internal/wire"
 )
 
 func TestInProcessHandshake(t *testing.T) {
-	s := NewServer()
+	serverKey := demoKeypair()
+	s := NewServer(serverKey)
 	hexpriv := "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
-	clientKey, err := w.NewKeyPairFromHex(hexpriv)
+	clientKey, err := identity.FromHex(hexpriv)
 	if err != nil {
 		t.Fatal(err)
 	}
 	c := NewClient(clientKey)
 
 	// 1. Client sends Hello
-	hello, err := c.Hello()
+	hello, err := c.Hello(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -26,12 +33,12 @@ func TestInProcessHandshake(t *testing.T) {
 	t.Logf("hello: %s", string(hello))
 
 	// Server responds with nonce
-	nonceRaw, err := s.HandleHello(hello)
+	nonceRaw, err := s.HandleHello(context.Background(), hello)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	var nonceMsg w.AuthMessage
+	var nonceMsg message.AuthMessage
 	if err := json.Unmarshal(nonceRaw, &nonceMsg); err != nil {
 		t.Fatalf("nonce decode: %v", err)
 	}
@@ -47,18 +54,25 @@ func TestInProcessHandshake(t *testing.T) {
 		}
 	}
 
+	if nonceMsg.IdentityKey != serverKey.PubHex() {
+		t.Fatalf("expected server identityKey %s, got %s", serverKey.PubHex(), nonceMsg.IdentityKey)
+	}
+
 	t.Logf("nonce: %v", nonceMsg.Payload)
 
-	// 2. Client sends Auth with signed nonce
-	auth, err := c.Auth(nonceMsg.Payload)
+	// 2. Client verifies the server and sends Auth with signed nonce
+	auth, err := c.HandleNonce(context.Background(), nonceRaw)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if c.ServerIdentityKey != serverKey.PubHex() {
+		t.Fatalf("client recorded server identity %s, want %s", c.ServerIdentityKey, serverKey.PubHex())
+	}
 
 	t.Logf("auth: %s", string(auth))
 
 	// Verify the auth message has correct shape
-	var authMsg w.AuthMessage
+	var authMsg message.AuthMessage
 	if err := json.Unmarshal(auth, &authMsg); err != nil {
 		t.Fatalf("auth decode: %v", err)
 	}
@@ -72,40 +86,55 @@ func TestInProcessHandshake(t *testing.T) {
 		t.Fatal("auth message missing signature")
 	}
 
-	// Verify signature independently
-	nonceBytes := make([]byte, len(nonceMsg.Payload))
-	for i, v := range nonceMsg.Payload {
-		nonceBytes[i] = byte(v)
+	// Verify signature independently over the handshake preimage
+	var helloMsg message.AuthMessage
+	if err := json.Unmarshal(hello, &helloMsg); err != nil {
+		t.Fatalf("hello decode: %v", err)
+	}
+	if !equalInts(nonceMsg.YourNonce, helloMsg.Nonce) {
+		t.Fatal("server did not echo the client nonce")
 	}
-	sigBytes, err := hex.DecodeString(authMsg.Signature)
+	preimage, err := w.HandshakePreimage(w.HandshakeParams{
+		Role:              w.RoleClient,
+		Version:           nonceMsg.Version,
+		OfferedVersions:   helloMsg.SupportedVersions,
+		ClientNonce:       BytesFromIntArray(helloMsg.Nonce),
+		ServerNonce:       BytesFromIntArray(nonceMsg.Payload),
+		ClientIdentityKey: clientKey.PubHex(),
+		ServerIdentityKey: serverKey.PubHex(),
+	})
 	if err != nil {
-		t.Fatalf("failed to decode signature hex: %v", err)
+		t.Fatal(err)
 	}
-	if !clientKey.Verify(nonceBytes, sigBytes) {
-		t.Fatal("signature verification failed")
+	keyID := w.SessionID(BytesFromIntArray(helloMsg.Nonce), BytesFromIntArray(nonceMsg.Payload))
+	if err := verifySignature(context.Background(), serverKey, clientKey.PubHex(), keyID, preimage, authMsg.Signature); err != nil {
+		t.Fatalf("signature verification failed: %v", err)
 	}
 
 	t.Log("signature verified successfully")
 
 	// Server responds with OK
-	okRaw, err := s.HandleAuth(auth)
+	okRaw, err := s.HandleAuth(context.Background(), auth)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	var okMsg w.AuthMessage
+	var okMsg message.AuthMessage
 	if err := json.Unmarshal(okRaw, &okMsg); err != nil {
 		t.Fatalf("ok decode: %v", err)
 	}
 	if okMsg.Type != "ok" {
 		t.Fatalf("expected type=ok, got %s", okMsg.Type)
 	}
+	if c.SessionID() == "" || c.SessionID() != s.SessionID() {
+		t.Fatalf("session IDs differ: client %q, server %q", c.SessionID(), s.SessionID())
+	}
 
 	t.Log("handshake complete: hello -> nonce -> auth -> ok")
 }
 
 func TestAuthMessageJSONRoundTrip(t *testing.T) {
-	msg := w.AuthMessage{
+	msg := message.AuthMessage{
 		Version:     "1",
 		Type:        "general",
 		IdentityKey: "abc123",
@@ -120,7 +149,7 @@ func TestAuthMessageJSONRoundTrip(t *testing.T) {
 
 	t.Logf("json: %s", string(data))
 
-	var decoded w.AuthMessage
+	var decoded message.AuthMessage
 	if err := json.Unmarshal(data, &decoded); err != nil {
 		t.Fatal(err)
 	}
@@ -170,3 +199,247 @@ func TestNonceIntArray(t *testing.T) {
 		t.Fatal("two consecutive nonces are identical — RNG issue")
 	}
 }
+
+func TestHandleAuthRejectsForgedSignature(t *testing.T) {
+	s := NewServer(demoKeypair())
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attackerKey, err := identity.FromHex("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(clientKey)
+	hello, err := c.Hello(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonceRaw, err := s.HandleHello(context.Background(), hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nonceMsg message.AuthMessage
+	if err := json.Unmarshal(nonceRaw, &nonceMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign the session with the wrong key but claim the client's identity
+	preimage, err := w.HandshakePreimage(w.HandshakeParams{
+		Role:              w.RoleClient,
+		Version:           nonceMsg.Version,
+		ClientNonce:       BytesFromIntArray(nonceMsg.YourNonce),
+		ServerNonce:       BytesFromIntArray(nonceMsg.Payload),
+		ClientIdentityKey: clientKey.PubHex(),
+		ServerIdentityKey: nonceMsg.IdentityKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := w.SessionID(BytesFromIntArray(nonceMsg.YourNonce), BytesFromIntArray(nonceMsg.Payload))
+	sig, err := createSignature(context.Background(), attackerKey, nonceMsg.IdentityKey, keyID, preimage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := json.Marshal(message.AuthMessage{
+		Version:     "1",
+		Type:        "auth",
+		Nonce:       nonceMsg.YourNonce,
+		Payload:     nonceMsg.Payload,
+		IdentityKey: clientKey.PubHex(),
+		Signature:   sig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.HandleAuth(context.Background(), forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestHandleAuthRejectsWrongNonce(t *testing.T) {
+	s := NewServer(demoKeypair())
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(clientKey)
+
+	hello, err := c.Hello(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HandleHello(context.Background(), hello); err != nil {
+		t.Fatal(err)
+	}
+
+	// A correctly signed auth over a nonce the server never issued
+	c.ServerIdentityKey = demoKeypair().PubHex()
+	c.Version = message.Version
+	auth, err := c.Auth(context.Background(), w.MakeNonceIntArray())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HandleAuth(context.Background(), auth); !errors.Is(err, ErrNonceMismatch) {
+		t.Fatalf("expected ErrNonceMismatch, got %v", err)
+	}
+}
+
+func TestHandleAuthBeforeHello(t *testing.T) {
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := json.Marshal(message.AuthMessage{
+		Version:     "1",
+		Type:        "auth",
+		IdentityKey: clientKey.PubHex(),
+		Nonce:       w.MakeNonceIntArray(),
+		Payload:     w.MakeNonceIntArray(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewServer(demoKeypair()).HandleAuth(context.Background(), auth); !errors.Is(err, ErrInvalidHandshake) {
+		t.Fatalf("expected ErrInvalidHandshake, got %v", err)
+	}
+}
+
+func TestHandleNonceRejectsImpostorServer(t *testing.T) {
+	serverKey := demoKeypair()
+	impostorKey, err := identity.FromHex("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(clientKey)
+	hello, err := c.Hello(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var helloMsg message.AuthMessage
+	if err := json.Unmarshal(hello, &helloMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The impostor signs with its own key but claims the real server identity
+	nonce := w.MakeNonceIntArray()
+	preimage, err := w.HandshakePreimage(w.HandshakeParams{
+		Role:              w.RoleServer,
+		Version:           "1",
+		OfferedVersions:   helloMsg.SupportedVersions,
+		ClientNonce:       BytesFromIntArray(helloMsg.Nonce),
+		ServerNonce:       BytesFromIntArray(nonce),
+		ClientIdentityKey: clientKey.PubHex(),
+		ServerIdentityKey: serverKey.PubHex(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := w.SessionID(BytesFromIntArray(helloMsg.Nonce), BytesFromIntArray(nonce))
+	sig, err := createSignature(context.Background(), impostorKey, clientKey.PubHex(), keyID, preimage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := json.Marshal(message.AuthMessage{
+		Version:     "1",
+		Type:        "nonce",
+		IdentityKey: serverKey.PubHex(),
+		YourNonce:   helloMsg.Nonce,
+		Payload:     nonce,
+		Signature:   sig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.HandleNonce(context.Background(), forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	if c.ServerIdentityKey != "" {
+		t.Fatal("client recorded an unverified server identity")
+	}
+}
+
+func TestHandleAuthRejectsReplayFromOtherSession(t *testing.T) {
+	serverKey := demoKeypair()
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Complete a first session and capture its auth message
+	c := NewClient(clientKey)
+	first := NewServer(serverKey)
+	hello, err := c.Hello(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonceRaw, err := first.HandleHello(context.Background(), hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captured, err := c.HandleNonce(context.Background(), nonceRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying the same hello and auth into a second session must fail
+	second := NewServer(serverKey)
+	if _, err := second.HandleHello(context.Background(), hello); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.HandleAuth(context.Background(), captured); !errors.Is(err, ErrNonceMismatch) {
+		t.Fatalf("expected ErrNonceMismatch, got %v", err)
+	}
+}
+
+// demoKeypair is the server identity used throughout the tests.
+func demoKeypair() *identity.KeyPair {
+	return identity.MustFromHex("1a2b3c4d5e6f708192a3b4c5d6e7f8090a1b2c3d4e5f60718293a4b5c6d7e8f9")
+}
+
+// metadataTransport adds fixed connection metadata to a transport.
+type metadataTransport struct {
+	transport.Transport
+	metadata map[string]string
+}
+
+func (m metadataTransport) Metadata() map[string]string { return m.metadata }
+
+// runHandshakePair runs a handshake between the test client identity and
+// demoKeypair over an in-memory transport whose server end reports the remote
+// address 10.0.0.7:5000, resuming session if it is not nil, and returns both
+// sides' sessions and errors.
+func runHandshakePair(t *testing.T, session *Session, clientOpts []ClientOption, serverOpts []ServerOption) (*Session, *Session, error, error) {
+	t.Helper()
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientT, serverT := transport.InMemoryPair()
+	serverT = metadataTransport{Transport: serverT, metadata: map[string]string{"remoteAddr": "10.0.0.7:5000"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var serverSession *Session
+	var serverErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serverSession, serverErr = RunServerHandshake(ctx, serverT, demoKeypair(), serverOpts...)
+	}()
+	clientSession, clientErr := RunClientResumption(ctx, clientT, wallet, session, clientOpts...)
+	if clientErr != nil {
+		// Unblock a server still waiting for auth
+		cancel()
+	}
+	wg.Wait()
+	return clientSession, serverSession, clientErr, serverErr
+}
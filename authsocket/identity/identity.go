@@ -0,0 +1,188 @@
+// Package identity holds the secp256k1 identity keys that authsocket parties
+// authenticate with. A *KeyPair satisfies authsocket.Wallet, so keys held
+// locally can be passed straight to a handshake.
+package identity
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	bsvhash "github.com/bsv-blockchain/go-sdk/primitives/hash"
+	"github.com/bsv-blockchain/go-sdk/wallet"
+)
+
+// KeyPair wrapper using go-sdk for cryptographic primitives
+type KeyPair struct {
+	Priv *ec.PrivateKey
+	Pub  *ec.PublicKey
+}
+
+func newKeyPair(k *ec.PrivateKey) *KeyPair {
+	return &KeyPair{Priv: k, Pub: k.PubKey()}
+}
+
+// Generate returns a new random identity key.
+func Generate() (*KeyPair, error) {
+	k, err := ec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return newKeyPair(k), nil
+}
+
+// FromHex loads an identity key from its 32-byte private key in hex.
+func FromHex(hexpriv string) (*KeyPair, error) {
+	k, err := ec.PrivateKeyFromHex(hexpriv)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyPair(k), nil
+}
+
+// FromWIF loads an identity key from a private key in Wallet Import Format.
+func FromWIF(wif string) (*KeyPair, error) {
+	k, err := ec.PrivateKeyFromWif(wif)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyPair(k), nil
+}
+
+// LoadFile loads an identity key from a file holding the private key as hex
+// or WIF. Surrounding whitespace is ignored.
+func LoadFile(path string) (*KeyPair, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimSpace(string(b))
+	if len(key) == 64 {
+		if kp, err := FromHex(key); err == nil {
+			return kp, nil
+		}
+	}
+	kp, err := FromWIF(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: key is neither hex nor WIF", path)
+	}
+	return kp, nil
+}
+
+// Sign signs the SHA-256 hash of the data using ECDSA
+func (kp *KeyPair) Sign(data []byte) ([]byte, error) {
+	h := bsvhash.Sha256(data)
+	sig, err := kp.Priv.Sign(h)
+	if err != nil {
+		return nil, err
+	}
+	// Use Serialize() which produces DER format suitable for transport
+	return sig.Serialize(), nil
+}
+
+// Verify verifies the ECDSA signature against the data.
+// Note: PublicKey.Verify() internally hashes the data with SHA-256,
+// while PrivateKey.Sign() expects a pre-computed hash.
+// So Sign hashes first, and Verify takes raw data.
+func (kp *KeyPair) Verify(data, sigBytes []byte) bool {
+	sig, err := ec.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	return kp.Pub.Verify(data, sig)
+}
+
+// ProtoWallet returns a go-sdk wallet over the key pair, for protocols such as
+// certificate field decryption that are defined in terms of wallet operations.
+func (kp *KeyPair) ProtoWallet() (*wallet.ProtoWallet, error) {
+	return wallet.NewProtoWallet(wallet.ProtoWalletArgs{Type: wallet.ProtoWalletArgsTypePrivateKey, PrivateKey: kp.Priv})
+}
+
+func (kp *KeyPair) PubKey() []byte {
+	return kp.Pub.Compressed()
+}
+
+func (kp *KeyPair) PubHex() string {
+	return hex.EncodeToString(kp.Pub.Compressed())
+}
+
+func (kp *KeyPair) PrivHex() string {
+	return hex.EncodeToString(kp.Priv.Serialize())
+}
+
+// WIF returns the private key in mainnet Wallet Import Format.
+func (kp *KeyPair) WIF() string {
+	return kp.Priv.Wif()
+}
+
+// MustFromHex is like FromHex but panics on an invalid key, for keys fixed at
+// compile time such as in tests.
+func MustFromHex(hexpriv string) *KeyPair {
+	kp, err := FromHex(hexpriv)
+	if err != nil {
+		panic(fmt.Sprintf("identity: %v", err))
+	}
+	return kp
+}
+
+// The methods below make *KeyPair a go-sdk wallet.KeyOperations, so a key pair
+// can be used wherever a wallet is expected. Each delegates to ProtoWallet.
+
+func (kp *KeyPair) GetPublicKey(ctx context.Context, args wallet.GetPublicKeyArgs, originator string) (*wallet.GetPublicKeyResult, error) {
+	pw, err := kp.ProtoWallet()
+	if err != nil {
+		return nil, err
+	}
+	return pw.GetPublicKey(ctx, args, originator)
+}
+
+func (kp *KeyPair) Encrypt(ctx context.Context, args wallet.EncryptArgs, originator string) (*wallet.EncryptResult, error) {
+	pw, err := kp.ProtoWallet()
+	if err != nil {
+		return nil, err
+	}
+	return pw.Encrypt(ctx, args, originator)
+}
+
+func (kp *KeyPair) Decrypt(ctx context.Context, args wallet.DecryptArgs, originator string) (*wallet.DecryptResult, error) {
+	pw, err := kp.ProtoWallet()
+	if err != nil {
+		return nil, err
+	}
+	return pw.Decrypt(ctx, args, originator)
+}
+
+func (kp *KeyPair) CreateHMAC(ctx context.Context, args wallet.CreateHMACArgs, originator string) (*wallet.CreateHMACResult, error) {
+	pw, err := kp.ProtoWallet()
+	if err != nil {
+		return nil, err
+	}
+	return pw.CreateHMAC(ctx, args, originator)
+}
+
+func (kp *KeyPair) VerifyHMAC(ctx context.Context, args wallet.VerifyHMACArgs, originator string) (*wallet.VerifyHMACResult, error) {
+	pw, err := kp.ProtoWallet()
+	if err != nil {
+		return nil, err
+	}
+	return pw.VerifyHMAC(ctx, args, originator)
+}
+
+func (kp *KeyPair) CreateSignature(ctx context.Context, args wallet.CreateSignatureArgs, originator string) (*wallet.CreateSignatureResult, error) {
+	pw, err := kp.ProtoWallet()
+	if err != nil {
+		return nil, err
+	}
+	return pw.CreateSignature(ctx, args, originator)
+}
+
+func (kp *KeyPair) VerifySignature(ctx context.Context, args wallet.VerifySignatureArgs, originator string) (*wallet.VerifySignatureResult, error) {
+	pw, err := kp.ProtoWallet()
+	if err != nil {
+		return nil, err
+	}
+	return pw.VerifySignature(ctx, args, originator)
+}
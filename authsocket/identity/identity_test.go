@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	kp, err := FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("hello world")
+	sig, err := kp.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("sig hex: %s", hex.EncodeToString(sig))
+	t.Logf("sig len: %d", len(sig))
+
+	if !kp.Verify(data, sig) {
+		t.Fatal("direct sign/verify round trip failed")
+	}
+
+	// Also test with hex encode/decode round trip (like the JSON transport does)
+	sigHex := hex.EncodeToString(sig)
+	sigBack, err := hex.DecodeString(sigHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !kp.Verify(data, sigBack) {
+		t.Fatal("hex round trip sign/verify failed")
+	}
+
+	t.Log("sign/verify round trip passed")
+}
+
+func TestLoadFile(t *testing.T) {
+	kp, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, contents := range map[string]string{"hex": kp.PrivHex() + "\n", "wif": kp.WIF() + "\n"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if loaded.PubHex() != kp.PubHex() {
+			t.Fatalf("%s: loaded %s, want %s", name, loaded.PubHex(), kp.PubHex())
+		}
+	}
+
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(bad); err == nil {
+		t.Fatal("expected error for malformed key file")
+	}
+}
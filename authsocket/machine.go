@@ -0,0 +1,364 @@
+package authsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+)
+
+// MaxBufferedMessages is how many general messages a handshake holds back
+// while authentication is still in progress before failing.
+const MaxBufferedMessages = 32
+
+// HandshakeState is the progress of a ClientHandshake or ServerHandshake.
+type HandshakeState int
+
+const (
+	// StateStart: the client has not sent its hello, or the server is
+	// waiting for one.
+	StateStart HandshakeState = iota
+	// StateAwaitNonce: the client has sent its hello.
+	StateAwaitNonce
+	// StateAwaitAuth: the server has sent its nonce.
+	StateAwaitAuth
+	// StateAwaitOK: the client has sent its auth.
+	StateAwaitOK
+	// StateAwaitResumed: the client has presented a resumption ticket.
+	StateAwaitResumed
+	// StateDone: the handshake succeeded and Session is available.
+	StateDone
+	// StateFailed: the handshake failed; see Err.
+	StateFailed
+)
+
+func (s HandshakeState) String() string {
+	switch s {
+	case StateStart:
+		return "start"
+	case StateAwaitNonce:
+		return "await-nonce"
+	case StateAwaitAuth:
+		return "await-auth"
+	case StateAwaitOK:
+		return "await-ok"
+	case StateAwaitResumed:
+		return "await-resumed"
+	case StateDone:
+		return "done"
+	case StateFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("HandshakeState(%d)", int(s))
+}
+
+// stage returns the handshake stage a message received in state s belongs to.
+func (s HandshakeState) stage() string {
+	switch s {
+	case StateAwaitNonce:
+		return StageNonce
+	case StateAwaitAuth:
+		return StageAuth
+	case StateAwaitOK:
+		return StageOK
+	case StateAwaitResumed:
+		return StageResume
+	}
+	return StageHello
+}
+
+// machine holds what both handshake sides share: the state, its observer and
+// the general messages that arrived early.
+type machine struct {
+	// OnTransition, if set, is called on every state change.
+	OnTransition func(from, to HandshakeState)
+
+	state    HandshakeState
+	err      error
+	session  *Session
+	resumed  bool
+	buffered [][]byte
+}
+
+// State returns the current state.
+func (m *machine) State() HandshakeState { return m.state }
+
+// Err returns the error the handshake failed with, if it failed.
+func (m *machine) Err() error { return m.err }
+
+// Session returns the session once the handshake is done, or nil. General
+// messages received before then are available from Session.Buffered.
+func (m *machine) Session() *Session { return m.session }
+
+// sentStage returns the handshake stage of the message sent on entering the
+// current state.
+func (m *machine) sentStage() string {
+	switch m.state {
+	case StateAwaitAuth:
+		return StageNonce
+	case StateAwaitOK:
+		return StageAuth
+	case StateAwaitResumed:
+		return StageResume
+	case StateDone:
+		if m.resumed {
+			return StageResume
+		}
+		return StageOK
+	}
+	return StageHello
+}
+
+func (m *machine) transition(to HandshakeState) {
+	from := m.state
+	m.state = to
+	if m.OnTransition != nil && from != to {
+		m.OnTransition(from, to)
+	}
+}
+
+// fail moves to StateFailed and returns err as a HandshakeError, together
+// with the error message to send the peer, if any.
+func (m *machine) fail(err error, peer string) ([][]byte, error) {
+	he := &HandshakeError{Stage: m.state.stage(), Op: OpProcess, PeerIdentity: peer, Err: err}
+	m.err = he
+	m.transition(StateFailed)
+	if reply := errorReply(err); reply != nil {
+		return [][]byte{reply}, he
+	}
+	return nil, he
+}
+
+// done attaches the buffered messages to session and finishes the handshake.
+func (m *machine) done(session *Session) {
+	session.recvMu.Lock()
+	session.buffered = append(session.buffered, m.buffered...)
+	session.recvMu.Unlock()
+	m.buffered = nil
+	m.session = session
+	m.transition(StateDone)
+}
+
+// classifyIncoming decodes raw and decides whether the caller should process
+// it. Stray messages (unknown types, or handshake messages the state does not
+// expect such as a repeated hello) are ignored, and general messages are
+// buffered. Frames that are not AuthMessages at all fail with
+// ErrMalformedMessage.
+func (m *machine) classifyIncoming(raw []byte, expected ...string) (*message.AuthMessage, bool, error) {
+	if m.state == StateDone || m.state == StateFailed {
+		return nil, false, nil
+	}
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if am.Type == message.TypeError || contains(expected, am.Type) {
+		return am, true, nil
+	}
+	if am.Type == message.TypeGeneral {
+		if len(m.buffered) >= MaxBufferedMessages {
+			return nil, false, fmt.Errorf("%w: more than %d general messages before authentication", ErrUnexpectedMessage, MaxBufferedMessages)
+		}
+		m.buffered = append(m.buffered, raw)
+	}
+	return nil, false, nil
+}
+
+// ClientHandshake is the client side of the handshake as a state machine. It
+// consumes incoming messages one at a time, without a transport, and returns
+// the messages to send in reply. Stray messages are ignored and general
+// messages that arrive early are held for the session.
+type ClientHandshake struct {
+	machine
+	client   *Client
+	wallet   Wallet
+	resuming *Session
+}
+
+// NewClientHandshake prepares a client handshake; call Start to begin it.
+func NewClientHandshake(wallet Wallet, opts ...ClientOption) *ClientHandshake {
+	cfg := newClientConfig(opts)
+	c := NewClient(wallet)
+	c.TrustedServerKeys = cfg.serverIdentityKeys
+	c.Certificates = cfg.certificates
+	c.Versions = cfg.versions
+	c.Features = cfg.features
+	c.Origin = cfg.origin
+	return &ClientHandshake{client: c, wallet: wallet}
+}
+
+// Start returns the hello to send.
+func (h *ClientHandshake) Start(ctx context.Context) ([][]byte, error) {
+	if h.state != StateStart {
+		return nil, fmt.Errorf("%w: handshake already started", ErrInvalidHandshake)
+	}
+	hello, err := h.client.Hello(ctx)
+	if err != nil {
+		return h.fail(err, "")
+	}
+	h.transition(StateAwaitNonce)
+	return [][]byte{hello}, nil
+}
+
+// Resume begins the handshake by presenting session's resumption ticket,
+// or with a hello like Start if it has none. If the server rejects the
+// ticket, Handle falls back to a full handshake and returns the hello.
+func (h *ClientHandshake) Resume(ctx context.Context, session *Session) ([][]byte, error) {
+	if session == nil || session.Ticket == "" {
+		return h.Start(ctx)
+	}
+	if h.state != StateStart {
+		return nil, fmt.Errorf("%w: handshake already started", ErrInvalidHandshake)
+	}
+	resume, err := h.client.Resume(ctx, session)
+	if err != nil {
+		return h.fail(err, session.PeerIdentityKey)
+	}
+	h.resuming = session
+	h.transition(StateAwaitResumed)
+	return [][]byte{resume}, nil
+}
+
+// Handle consumes one incoming message and returns the messages to send in
+// reply. On failure it returns a *HandshakeError together with the error
+// message for the server, which should still be sent.
+func (h *ClientHandshake) Handle(ctx context.Context, raw []byte) ([][]byte, error) {
+	expected := message.TypeNonce
+	switch h.state {
+	case StateStart:
+		return nil, nil
+	case StateAwaitOK:
+		expected = message.TypeOK
+	case StateAwaitResumed:
+		expected = message.TypeResumed
+	}
+	am, ok, err := h.classifyIncoming(raw, expected)
+	if err != nil {
+		return h.fail(err, h.client.ServerIdentityKey)
+	}
+	if !ok {
+		return nil, nil
+	}
+	if am.Type == message.TypeError {
+		err := remoteError(am)
+		if h.state == StateAwaitResumed && errors.Is(err, ErrResumeRejected) {
+			// The server no longer knows the session; authenticate afresh.
+			h.resuming = nil
+			h.transition(StateStart)
+			return h.Start(ctx)
+		}
+		return h.fail(err, h.client.ServerIdentityKey)
+	}
+
+	switch h.state {
+	case StateAwaitNonce:
+		auth, err := h.client.HandleNonce(ctx, raw)
+		if err != nil {
+			return h.fail(err, h.client.ServerIdentityKey)
+		}
+		h.transition(StateAwaitOK)
+		return [][]byte{auth}, nil
+	case StateAwaitOK:
+		c := h.client
+		session, err := newSession(ctx, h.wallet, c.identityKey, c.ServerIdentityKey, BytesFromIntArray(c.nonce), BytesFromIntArray(c.serverNonce))
+		if err != nil {
+			return h.fail(err, c.ServerIdentityKey)
+		}
+		session.Version = c.Version
+		session.Features = c.NegotiatedFeatures
+		session.Ticket = am.Ticket
+		h.done(session)
+	case StateAwaitResumed:
+		if err := h.client.HandleResumed(ctx, raw, h.resuming); err != nil {
+			return h.fail(err, h.resuming.PeerIdentityKey)
+		}
+		h.resumed = true
+		h.done(h.resuming)
+	}
+	return nil, nil
+}
+
+// ServerHandshake is the server side of the handshake as a state machine. It
+// consumes incoming messages one at a time, without a transport, and returns
+// the messages to send in reply. Stray messages and repeated hellos are
+// ignored, and general messages that arrive early are held for the session.
+type ServerHandshake struct {
+	machine
+	server *Server
+	wallet Wallet
+}
+
+// NewServerHandshake prepares a server handshake waiting for a hello.
+// Connection metadata for the Authorizer can be set on Server().Metadata.
+func NewServerHandshake(wallet Wallet, opts ...ServerOption) *ServerHandshake {
+	s := NewServer(wallet)
+	newServerConfig(opts).apply(s)
+	return &ServerHandshake{server: s, wallet: wallet}
+}
+
+// Server returns the underlying per-handshake Server.
+func (h *ServerHandshake) Server() *Server { return h.server }
+
+// Handle consumes one incoming message and returns the messages to send in
+// reply. On failure it returns a *HandshakeError together with the error
+// message for the client, which should still be sent. A resume message whose
+// ticket is rejected is answered with an error message, after which the
+// client may still send a hello.
+func (h *ServerHandshake) Handle(ctx context.Context, raw []byte) ([][]byte, error) {
+	expected := []string{message.TypeHello, message.TypeResume}
+	if h.state == StateAwaitAuth {
+		expected = []string{message.TypeAuth}
+	}
+	am, ok, err := h.classifyIncoming(raw, expected...)
+	if err != nil {
+		return h.fail(err, h.server.identityKey)
+	}
+	if !ok {
+		return nil, nil
+	}
+	if am.Type == message.TypeError {
+		return h.fail(remoteError(am), h.server.identityKey)
+	}
+
+	s := h.server
+	switch {
+	case am.Type == message.TypeResume:
+		resumed, session, err := s.HandleResume(ctx, raw)
+		if errors.Is(err, ErrResumeRejected) {
+			return [][]byte{errorReply(err)}, nil
+		}
+		if err != nil {
+			return h.fail(err, am.IdentityKey)
+		}
+		h.resumed = true
+		h.done(session)
+		return [][]byte{resumed}, nil
+	case h.state == StateStart:
+		nonce, err := s.HandleHello(ctx, raw)
+		if err != nil {
+			return h.fail(err, am.IdentityKey)
+		}
+		h.transition(StateAwaitAuth)
+		return [][]byte{nonce}, nil
+	case h.state == StateAwaitAuth:
+		ok, err := s.HandleAuth(ctx, raw)
+		if err != nil {
+			return h.fail(err, s.identityKey)
+		}
+		session, err := newSession(ctx, h.wallet, s.localKey, s.identityKey, BytesFromIntArray(s.clientNonce), BytesFromIntArray(s.nonce))
+		if err != nil {
+			return h.fail(err, s.identityKey)
+		}
+		session.Version = s.version
+		session.Features = s.features
+		session.Certificates = s.Certificates()
+		session.setClaims(s.Claims())
+		if s.tickets != nil {
+			s.tickets.put(session, s.ticket)
+		}
+		h.done(session)
+		return [][]byte{ok}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,158 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+)
+
+// singleReply returns a function that takes a handshake step's results and
+// returns its only message, failing t otherwise.
+func singleReply(t *testing.T) func([][]byte, error) []byte {
+	return func(out [][]byte, err error) []byte {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 {
+			t.Fatalf("expected one message, got %d", len(out))
+		}
+		return out[0]
+	}
+}
+
+func TestHandshakeMachines(t *testing.T) {
+	ctx := context.Background()
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientHandshake(clientKey)
+	server := NewServerHandshake(demoKeypair())
+	single := singleReply(t)
+	var transitions []string
+	client.OnTransition = func(from, to HandshakeState) {
+		transitions = append(transitions, from.String()+">"+to.String())
+	}
+	ping := []byte(`{"version":"1","type":"ping"}`)
+
+	hello := single(client.Start(ctx))
+	nonce := single(server.Handle(ctx, hello))
+
+	// A repeated hello and an unknown message type are ignored.
+	for _, raw := range [][]byte{hello, ping} {
+		if out, err := server.Handle(ctx, raw); err != nil || len(out) != 0 {
+			t.Fatalf("expected stray message to be ignored, got %d replies, %v", len(out), err)
+		}
+	}
+	if server.State() != StateAwaitAuth {
+		t.Fatalf("expected server in await-auth, got %s", server.State())
+	}
+
+	if out, err := client.Handle(ctx, ping); err != nil || len(out) != 0 {
+		t.Fatalf("expected stray message to be ignored, got %d replies, %v", len(out), err)
+	}
+	auth := single(client.Handle(ctx, nonce))
+	ok := single(server.Handle(ctx, auth))
+	if server.State() != StateDone || server.Session() == nil {
+		t.Fatalf("expected server done with a session, got %s", server.State())
+	}
+
+	// A general message overtaking ok is held until the client is done.
+	early, err := server.Session().Seal(ctx, []byte("early"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := client.Handle(ctx, early); err != nil || len(out) != 0 {
+		t.Fatalf("expected early message to be buffered, got %d replies, %v", len(out), err)
+	}
+	if out, err := client.Handle(ctx, ok); err != nil || len(out) != 0 {
+		t.Fatalf("expected no reply to ok, got %d replies, %v", len(out), err)
+	}
+	if client.State() != StateDone {
+		t.Fatalf("expected client done, got %s", client.State())
+	}
+
+	want := []string{"start>await-nonce", "await-nonce>await-ok", "await-ok>done"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions: got %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions: got %v, want %v", transitions, want)
+		}
+	}
+
+	session := client.Session()
+	if session.ID != server.Session().ID {
+		t.Fatal("client and server derived different session IDs")
+	}
+	buffered := session.Buffered()
+	if len(buffered) != 1 {
+		t.Fatalf("expected one buffered message, got %d", len(buffered))
+	}
+	payload, err := session.Open(ctx, buffered[0])
+	if err != nil || string(payload) != "early" {
+		t.Fatalf("expected buffered payload %q, got %q, %v", "early", payload, err)
+	}
+	if len(session.Buffered()) != 0 {
+		t.Fatal("expected Buffered to forget returned messages")
+	}
+}
+
+func TestServerHandshakeRejectsForgedAuth(t *testing.T) {
+	ctx := context.Background()
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientHandshake(clientKey)
+	server := NewServerHandshake(demoKeypair())
+	single := singleReply(t)
+
+	nonce := single(server.Handle(ctx, single(client.Start(ctx))))
+	auth := single(client.Handle(ctx, nonce))
+
+	var am message.AuthMessage
+	if err := json.Unmarshal(auth, &am); err != nil {
+		t.Fatal(err)
+	}
+	am.Signature = "3006020101020101"
+	forged, _ := json.Marshal(am)
+
+	out, err := server.Handle(ctx, forged)
+	var he *HandshakeError
+	if !errors.As(err, &he) || he.Stage != StageAuth || !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected invalid signature at auth, got %v", err)
+	}
+	if server.State() != StateFailed || server.Err() != err {
+		t.Fatalf("expected server failed with %v, got %s", err, server.State())
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected an error reply, got %d messages", len(out))
+	}
+
+	// The client fails with the server's reason and does not answer it.
+	out, err = client.Handle(ctx, out[0])
+	var re *RemoteError
+	if !errors.As(err, &re) || re.Code != message.CodeBadSignature || len(out) != 0 {
+		t.Fatalf("expected remote bad_signature without reply, got %v (%d replies)", err, len(out))
+	}
+}
+
+func TestHandshakeMachineBufferLimit(t *testing.T) {
+	server := NewServerHandshake(demoKeypair())
+	general := []byte(`{"version":"1","type":"general","seq":1}`)
+	for i := 0; i < MaxBufferedMessages; i++ {
+		if _, err := server.Handle(context.Background(), general); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if _, err := server.Handle(context.Background(), general); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("expected ErrUnexpectedMessage past the buffer limit, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Package message defines the JSON messages exchanged by authsocket peers,
+// matching the TypeScript AuthMessage wire format.
+package message
+
+import (
+	"encoding/json"
+
+	"github.com/bsv-blockchain/go-sdk/auth/certificates"
+)
+
+// Message types.
+const (
+	TypeHello   = "hello"
+	TypeNonce   = "nonce"
+	TypeAuth    = "auth"
+	TypeOK      = "ok"
+	TypeGeneral = "general"
+	TypeError   = "error"
+	TypeResume  = "resume"
+	TypeResumed = "resumed"
+
+	TypeChallenge         = "challenge"
+	TypeChallengeResponse = "challengeResponse"
+)
+
+// Version is the original protocol version, assumed for a hello that does
+// not list SupportedVersions.
+const Version = "1"
+
+// Error codes carried in error messages.
+const (
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeBadSignature       = "bad_signature"
+	CodeUnauthorized       = "unauthorized"
+	CodeServerBusy         = "server_busy"
+	CodeNonceExpired       = "nonce_expired"
+	CodeInvalidCertificate = "invalid_certificate"
+	CodeInvalidHandshake   = "invalid_handshake"
+	CodeHandshakeTimeout   = "handshake_timeout"
+	CodeResumeRejected     = "resume_rejected"
+	CodeSessionExpired     = "session_expired"
+	CodeInternal           = "internal_error"
+)
+
+// AuthMessage is a single handshake or general message. Byte strings such as
+// nonces and payloads are encoded as arrays of integers 0-255.
+type AuthMessage struct {
+	Version               string                                `json:"version"`
+	Type                  string                                `json:"type"`
+	IdentityKey           string                                `json:"identityKey,omitempty"`
+	Nonce                 []int                                 `json:"nonce,omitempty"`
+	YourNonce             []int                                 `json:"yourNonce,omitempty"`
+	Seq                   uint64                                `json:"seq,omitempty"`
+	Payload               []int                                 `json:"payload,omitempty"`
+	Signature             string                                `json:"signature,omitempty"`
+	SupportedVersions     []string                              `json:"supportedVersions,omitempty"`
+	Features              []string                              `json:"features,omitempty"`
+	Code                  string                                `json:"code,omitempty"`
+	Reason                string                                `json:"reason,omitempty"`
+	Retryable             bool                                  `json:"retryable,omitempty"`
+	Ticket                string                                `json:"ticket,omitempty"`
+	Certificates          []*certificates.VerifiableCertificate `json:"certificates,omitempty"`
+	RequestedCertificates *RequestedCertificates                `json:"requestedCertificates,omitempty"`
+}
+
+// RequestedCertificates is the certificate request a server sends with its
+// nonce, in the BRC-103 JSON shape: the certifier identity keys it trusts and,
+// per base64 certificate type, the fields the client must reveal.
+type RequestedCertificates struct {
+	Certifiers []string            `json:"certifiers"`
+	Types      map[string][]string `json:"types"`
+}
+
+func (a *AuthMessage) MarshalJSON() ([]byte, error) {
+	type Alias AuthMessage
+	return json.Marshal((*Alias)(a))
+}
+
+func (a *AuthMessage) UnmarshalJSON(data []byte) error {
+	type Alias AuthMessage
+	aux := &Alias{}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*a = AuthMessage(*aux)
+	return nil
+}
@@ -0,0 +1,75 @@
+package authsocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultNonceTTL is how long a server nonce stays redeemable after HandleHello.
+const DefaultNonceTTL = time.Minute
+
+// sweepInterval is how often in-memory stores look for expired entries to
+// evict, so that the cost of a sweep is spread over many insertions.
+const sweepInterval = time.Second
+
+// NonceStore records the nonces a server issues so that each one can be
+// redeemed by exactly one auth message before it expires. Implementations
+// must be safe for concurrent use. Backing it with a shared store lets several
+// server instances behind a load balancer reject each other's replays.
+type NonceStore interface {
+	// Issue records nonce as outstanding until expires.
+	Issue(ctx context.Context, nonce string, expires time.Time) error
+	// Redeem consumes nonce. It returns ErrNonceUnknown if the nonce was
+	// never issued, has expired or has already been redeemed.
+	Redeem(ctx context.Context, nonce string) error
+}
+
+// MemoryNonceStore is the default in-process NonceStore. Expired entries are
+// evicted when a new nonce is issued, at most once a second.
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time), now: time.Now}
+}
+
+func (m *MemoryNonceStore) Issue(_ context.Context, nonce string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now := m.now(); !now.Before(m.nextSweep) {
+		for n, exp := range m.nonces {
+			if !now.Before(exp) {
+				delete(m.nonces, n)
+			}
+		}
+		m.nextSweep = now.Add(sweepInterval)
+	}
+	m.nonces[nonce] = expires
+	return nil
+}
+
+func (m *MemoryNonceStore) Redeem(_ context.Context, nonce string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	exp, ok := m.nonces[nonce]
+	if !ok {
+		return ErrNonceUnknown
+	}
+	delete(m.nonces, nonce)
+	if !m.now().Before(exp) {
+		return ErrNonceUnknown
+	}
+	return nil
+}
+
+// Len returns the number of outstanding nonces, including expired ones not yet evicted.
+func (m *MemoryNonceStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.nonces)
+}
@@ -0,0 +1,127 @@
+package authsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+)
+
+func TestMemoryNonceStoreRedeemOnce(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryNonceStore()
+
+	if err := store.Issue(ctx, "n1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Redeem(ctx, "n1"); err != nil {
+		t.Fatalf("first redeem: %v", err)
+	}
+	if err := store.Redeem(ctx, "n1"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("expected ErrNonceUnknown on second redeem, got %v", err)
+	}
+	if err := store.Redeem(ctx, "never-issued"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("expected ErrNonceUnknown for unissued nonce, got %v", err)
+	}
+}
+
+func TestMemoryNonceStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryNonceStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	if err := store.Issue(ctx, "old", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Second)
+	if err := store.Redeem(ctx, "old"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("expected ErrNonceUnknown for expired nonce, got %v", err)
+	}
+
+	// Expired entries are evicted when new nonces are issued
+	if err := store.Issue(ctx, "stale", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Second)
+	if err := store.Issue(ctx, "fresh", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("expected 1 outstanding nonce after eviction, got %d", store.Len())
+	}
+
+	// Within a second of a sweep, expired entries wait for the next one
+	now = now.Add(2 * time.Second)
+	if err := store.Issue(ctx, "unswept", now.Add(100*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("expected 1 outstanding nonce after eviction, got %d", store.Len())
+	}
+	now = now.Add(500 * time.Millisecond)
+	if err := store.Issue(ctx, "next", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("expected 2 outstanding nonces between sweeps, got %d", store.Len())
+	}
+}
+
+func TestHandleAuthRejectsReplayIntoSameServer(t *testing.T) {
+	ctx := context.Background()
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(demoKeypair())
+	c := NewClient(clientKey)
+
+	hello, err := c.Hello(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonceRaw, err := s.HandleHello(ctx, hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := c.HandleNonce(context.Background(), nonceRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HandleAuth(ctx, auth); err != nil {
+		t.Fatalf("first auth: %v", err)
+	}
+	if _, err := s.HandleAuth(ctx, auth); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("expected ErrNonceUnknown on replay, got %v", err)
+	}
+}
+
+func TestHandleAuthRejectsExpiredNonce(t *testing.T) {
+	ctx := context.Background()
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(demoKeypair())
+	s.NonceTTL = -time.Second
+	c := NewClient(clientKey)
+
+	hello, err := c.Hello(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonceRaw, err := s.HandleHello(ctx, hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := c.HandleNonce(context.Background(), nonceRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HandleAuth(ctx, auth); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("expected ErrNonceUnknown for expired nonce, got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package authsocket
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/auth/certificates"
+)
+
+// ClientOption configures the client side of the handshake.
+type ClientOption func(*clientConfig)
+
+type clientConfig struct {
+	serverIdentityKeys []string
+	certificates       CertificateProvider
+	versions           []string
+	features           []string
+	origin             string
+}
+
+func newClientConfig(opts []ClientOption) *clientConfig {
+	cfg := &clientConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithServerIdentityKeys pins the handshake to servers that prove one of the
+// given identity keys (compressed public key hex).
+// A server proving any other identity fails with ErrServerIdentityMismatch.
+func WithServerIdentityKeys(keys ...string) ClientOption {
+	return func(cfg *clientConfig) {
+		for _, k := range keys {
+			cfg.serverIdentityKeys = append(cfg.serverIdentityKeys, strings.ToLower(k))
+		}
+	}
+}
+
+// WithCertificates presents, when the server requests certificates, every
+// given certificate whose certifier and type were requested. Their keyrings
+// must already be created for the server's identity key.
+func WithCertificates(certs ...*certificates.VerifiableCertificate) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.certificates = staticCertificates(certs)
+	}
+}
+
+// WithCertificateProvider answers server certificate requests with p, which
+// can create keyrings for the server identity it is given.
+func WithCertificateProvider(p CertificateProvider) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.certificates = p
+	}
+}
+
+// WithVersions offers only the given protocol versions, most preferred first,
+// instead of SupportedVersions.
+func WithVersions(versions ...string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.versions = versions
+	}
+}
+
+// WithFeatures advertises optional features in the hello. The session lists
+// those the server supports too.
+func WithFeatures(features ...string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.features = features
+	}
+}
+
+// WithServerOrigin sets the origin of the server being connected to, such as
+// the WebSocket URL dialled. Both handshake signatures cover it, so a server
+// configured with a different origin (WithOrigin) fails the handshake with
+// ErrInvalidSignature.
+func WithServerOrigin(origin string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.origin = origin
+	}
+}
+
+// ServerOption configures the server side of the handshake.
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	nonceStore            NonceStore
+	nonceTTL              time.Duration
+	requestedCertificates *CertificateRequest
+	authorizer            Authorizer
+	versions              []string
+	features              []string
+	origin                string
+	maxClients            int
+	helloTimeout          time.Duration
+	authTimeout           time.Duration
+	handshakeTimeout      time.Duration
+	tickets               *sessionCache
+	sessionLifetime       time.Duration
+}
+
+func newServerConfig(opts []ServerOption) *serverConfig {
+	cfg := &serverConfig{
+		nonceTTL:         DefaultNonceTTL,
+		helloTimeout:     DefaultHelloTimeout,
+		authTimeout:      DefaultAuthTimeout,
+		handshakeTimeout: DefaultHandshakeTimeout,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// apply configures a per-handshake Server from cfg.
+func (cfg *serverConfig) apply(s *Server) {
+	if cfg.nonceStore != nil {
+		s.Nonces = cfg.nonceStore
+	}
+	s.NonceTTL = cfg.nonceTTL
+	s.RequestedCertificates = cfg.requestedCertificates
+	s.Authorizer = cfg.authorizer
+	s.Versions = cfg.versions
+	s.Features = cfg.features
+	s.Origin = cfg.origin
+	s.tickets = cfg.tickets
+}
+
+// WithNonceStore records issued nonces in store instead of a fresh in-memory
+// store per handshake. Share one store between server instances to reject
+// replays across them.
+func WithNonceStore(store NonceStore) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.nonceStore = store
+	}
+}
+
+// WithNonceTTL sets how long a client has to answer an issued nonce.
+func WithNonceTTL(ttl time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.nonceTTL = ttl
+	}
+}
+
+// WithRequestedCertificates asks every client for certificates matching req
+// during the handshake. Clients that do not present valid certificates from
+// the listed certifiers, covering every listed type and revealing every listed
+// field, fail with ErrInvalidCertificate.
+func WithRequestedCertificates(req CertificateRequest) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.requestedCertificates = &req
+	}
+}
+
+// WithAuthorizer consults a for every client after its signature and
+// certificates are verified and before the server sends ok.
+func WithAuthorizer(a Authorizer) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.authorizer = a
+	}
+}
+
+// WithAcceptedVersions accepts only the given protocol versions, most
+// preferred first, instead of SupportedVersions. Clients offering none of
+// them fail with ErrUnsupportedVersion.
+func WithAcceptedVersions(versions ...string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.versions = versions
+	}
+}
+
+// WithAcceptedFeatures lists the optional features the server supports.
+func WithAcceptedFeatures(features ...string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.features = features
+	}
+}
+
+// WithOrigin sets the server's own origin, such as "https://example.com", for
+// handshake signatures. Clients must be configured with WithServerOrigin for
+// the same origin.
+func WithOrigin(origin string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.origin = origin
+	}
+}
+
+// WithMaxClients limits an AuthSocketServer to n clients, counting both
+// connected clients and handshakes in progress. Further clients are refused
+// with a retryable server_busy error message and AcceptClient returns
+// ErrServerBusy. It has no effect on RunServerHandshake.
+func WithMaxClients(n int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.maxClients = n
+	}
+}
+
+// WithHelloTimeout sets how long the server waits for a client's hello after
+// the handshake starts. Zero disables the limit.
+func WithHelloTimeout(d time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.helloTimeout = d
+	}
+}
+
+// WithAuthTimeout sets how long the server waits for a client's auth after
+// sending its nonce. Zero disables the limit.
+func WithAuthTimeout(d time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.authTimeout = d
+	}
+}
+
+// WithHandshakeTimeout bounds the whole server handshake, however long the
+// caller's context allows. Zero disables the limit.
+func WithHandshakeTimeout(d time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.handshakeTimeout = d
+	}
+}
+
+// WithSessionLifetime makes an AuthSocketServer challenge each client over
+// its existing connection once d has passed since the client last
+// authenticated. AuthSocketClient answers automatically through its wallet.
+// Clients that do not answer within the auth timeout (DefaultAuthTimeout if
+// WithAuthTimeout disabled it), answer with a bad signature, or that the
+// Authorizer now denies are disconnected, and the error, matching
+// ErrSessionExpired, is reported through OnError. It has no effect on
+// RunServerHandshake; see Session.Challenge.
+func WithSessionLifetime(d time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.sessionLifetime = d
+	}
+}
+
+// WithResumption issues clients a resumption ticket, valid for ttl
+// (DefaultTicketTTL if zero), in the ok message. A client presenting it on a
+// new connection continues the same session in one round trip; see
+// RunClientResumption. Sessions stay resumable in memory until their ticket
+// expires; handshakes configured with the same option share them.
+func WithResumption(ttl time.Duration) ServerOption {
+	if ttl <= 0 {
+		ttl = DefaultTicketTTL
+	}
+	cache := newSessionCache(ttl)
+	return func(cfg *serverConfig) {
+		cfg.tickets = cache
+	}
+}
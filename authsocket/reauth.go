@@ -0,0 +1,124 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/internal/wire"
+)
+
+// AuthenticatedAt returns when the peer last proved it holds its identity
+// key: in the handshake, on resumption, or by answering a challenge.
+func (s *Session) AuthenticatedAt() time.Time {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return s.authenticatedAt
+}
+
+func (s *Session) markAuthenticated() {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	s.authenticatedAt = time.Now()
+}
+
+// Claims returns the claims the server's Authorizer attached to the session,
+// on the server side only. Re-authentication replaces the map rather than
+// modifying it; callers must not modify it either.
+func (s *Session) Claims() map[string]interface{} {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return s.claims
+}
+
+func (s *Session) setClaims(claims map[string]interface{}) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	s.claims = claims
+}
+
+// Challenge returns a challenge message asking the peer to prove again, over
+// the existing connection, that it holds its identity key. The answer is
+// checked with VerifyChallengeResponse; only the latest challenge can be
+// answered.
+func (s *Session) Challenge(ctx context.Context) ([]byte, error) {
+	nonce := wire.MakeNonceIntArray()
+	s.authMu.Lock()
+	s.challenge = nonce
+	s.authMu.Unlock()
+	return json.Marshal(message.AuthMessage{
+		Version:     s.Version,
+		Type:        message.TypeChallenge,
+		IdentityKey: s.LocalIdentityKey,
+		Nonce:       nonce,
+	})
+}
+
+// AnswerChallenge signs a challenge from the peer with the session's wallet
+// and returns the challengeResponse message.
+func (s *Session) AnswerChallenge(ctx context.Context, raw []byte) ([]byte, error) {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	if am.Type != message.TypeChallenge {
+		return nil, unexpectedMessage(am.Type, message.TypeChallenge)
+	}
+	if len(am.Nonce) != 32 {
+		return nil, fmt.Errorf("%w: challenge nonce must be 32 bytes, got %d", ErrInvalidHandshake, len(am.Nonce))
+	}
+	preimage, err := wire.ReauthPreimage(s.ID, BytesFromIntArray(am.Nonce))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := createSignature(ctx, s.wallet, s.PeerIdentityKey, s.ID, preimage)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(message.AuthMessage{
+		Version:     s.Version,
+		Type:        message.TypeChallengeResponse,
+		IdentityKey: s.LocalIdentityKey,
+		YourNonce:   am.Nonce,
+		Signature:   sig,
+	})
+}
+
+// VerifyChallengeResponse checks the peer's answer to the latest Challenge
+// and, if it is signed by the peer's identity key, renews AuthenticatedAt.
+func (s *Session) VerifyChallengeResponse(ctx context.Context, raw []byte) error {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return err
+	}
+	if am.Type != message.TypeChallengeResponse {
+		return unexpectedMessage(am.Type, message.TypeChallengeResponse)
+	}
+	if am.IdentityKey != s.PeerIdentityKey {
+		return ErrIdentityMismatch
+	}
+	s.authMu.Lock()
+	challenge := s.challenge
+	s.authMu.Unlock()
+	if challenge == nil || !equalInts(am.YourNonce, challenge) {
+		return ErrNonceMismatch
+	}
+	preimage, err := wire.ReauthPreimage(s.ID, BytesFromIntArray(challenge))
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(ctx, s.wallet, s.PeerIdentityKey, s.ID, preimage, am.Signature); err != nil {
+		return err
+	}
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if !equalInts(s.challenge, challenge) {
+		// A newer challenge was issued meanwhile.
+		return ErrNonceMismatch
+	}
+	s.challenge = nil
+	s.authenticatedAt = time.Now()
+	return nil
+}
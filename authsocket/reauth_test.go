@@ -0,0 +1,214 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+func TestSessionChallenge(t *testing.T) {
+	client, server := sessionPair(t)
+	ctx := context.Background()
+	before := server.AuthenticatedAt()
+
+	challenge, err := server.Challenge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := client.AnswerChallenge(ctx, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.VerifyChallengeResponse(ctx, answer); err != nil {
+		t.Fatal(err)
+	}
+	if !server.AuthenticatedAt().After(before) {
+		t.Fatal("expected AuthenticatedAt to be renewed")
+	}
+	if err := server.VerifyChallengeResponse(ctx, answer); !errors.Is(err, ErrNonceMismatch) {
+		t.Fatalf("expected a used answer to fail with ErrNonceMismatch, got %v", err)
+	}
+
+	// The old signature does not answer a new challenge.
+	var am message.AuthMessage
+	if err := json.Unmarshal(answer, &am); err != nil {
+		t.Fatal(err)
+	}
+	challenge, err = server.Challenge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cm message.AuthMessage
+	if err := json.Unmarshal(challenge, &cm); err != nil {
+		t.Fatal(err)
+	}
+	am.YourNonce = cm.Nonce
+	forged, _ := json.Marshal(am)
+	if err := server.VerifyChallengeResponse(ctx, forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+// connectAuthSocket connects an AuthSocketClient to server over an in-memory
+// transport.
+func connectAuthSocket(t *testing.T, ctx context.Context, server *AuthSocketServer, wallet *identity.KeyPair) *AuthSocketClient {
+	t.Helper()
+	clientT, serverT := transport.InMemoryPair()
+	go server.AcceptClient(ctx, serverT)
+	client := NewAuthSocketClient(clientT, wallet)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAuthSocketServerReauthenticates(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair(), WithSessionLifetime(30*time.Millisecond))
+	server.OnError(func(identityKey string, err error) {
+		t.Errorf("unexpected error: %v", err)
+	})
+	connectAuthSocket(t, ctx, server, wallet)
+	session, ok := server.Session(wallet.PubHex())
+	if !ok {
+		t.Fatal("client not connected")
+	}
+	authenticated := session.AuthenticatedAt()
+
+	time.Sleep(150 * time.Millisecond)
+	if !session.AuthenticatedAt().After(authenticated.Add(30 * time.Millisecond)) {
+		t.Fatal("expected the client to have re-authenticated")
+	}
+	if _, ok := server.Session(wallet.PubHex()); !ok {
+		t.Fatal("expected the client to stay connected")
+	}
+}
+
+func TestAuthSocketServerRefreshesClaims(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var decisions atomic.Int64
+	server := NewAuthSocketServer(nil, demoKeypair(),
+		WithSessionLifetime(10*time.Millisecond),
+		WithAuthorizer(AuthorizerFunc(func(ctx context.Context, req AuthorizationRequest) (Decision, error) {
+			return Allow(map[string]interface{}{"decision": decisions.Add(1)}), nil
+		})))
+	server.OnError(func(identityKey string, err error) {
+		t.Errorf("unexpected error: %v", err)
+	})
+	connectAuthSocket(t, ctx, server, wallet)
+	session, ok := server.Session(wallet.PubHex())
+	if !ok {
+		t.Fatal("client not connected")
+	}
+
+	// Claims are read while re-authentication replaces them; run with -race.
+	first := session.Claims()["decision"]
+	for session.Claims()["decision"] == first {
+		if ctx.Err() != nil {
+			t.Fatal("claims were not refreshed on re-authentication")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAuthSocketServerExpiresRevokedClient(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var revoked atomic.Bool
+	server := NewAuthSocketServer(nil, demoKeypair(),
+		WithSessionLifetime(30*time.Millisecond),
+		WithAuthorizer(AuthorizerFunc(func(ctx context.Context, req AuthorizationRequest) (Decision, error) {
+			if revoked.Load() {
+				return Deny("key revoked"), nil
+			}
+			return Allow(nil), nil
+		})))
+	serverErr := make(chan error, 1)
+	server.OnError(func(identityKey string, err error) { serverErr <- err })
+
+	client := connectAuthSocket(t, ctx, server, wallet)
+	clientErr := make(chan error, 1)
+	client.OnError(func(err error) { clientErr <- err })
+	revoked.Store(true)
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, ErrSessionExpired) || !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("expected an expired, unauthorized session, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("session was not expired")
+	}
+	if _, ok := server.Session(wallet.PubHex()); ok {
+		t.Fatal("expected the client to be disconnected")
+	}
+	select {
+	case err := <-clientErr:
+		var re *RemoteError
+		if !errors.As(err, &re) || re.Code != message.CodeUnauthorized {
+			t.Fatalf("expected the client to be told it is unauthorized, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("client was not told why it was disconnected")
+	}
+}
+
+func TestAuthSocketServerExpiresSilentClient(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair(),
+		WithSessionLifetime(20*time.Millisecond), WithAuthTimeout(30*time.Millisecond))
+	serverErr := make(chan error, 1)
+	server.OnError(func(identityKey string, err error) { serverErr <- err })
+
+	// A client that completes the handshake but never answers challenges.
+	clientT, serverT := transport.InMemoryPair()
+	go server.AcceptClient(ctx, serverT)
+	if _, err := RunClientHandshake(ctx, clientT, wallet); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for len(types) < 2 {
+		raw, err := clientT.Receive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, messageType(raw))
+	}
+	if types[0] != message.TypeChallenge || types[1] != message.TypeError {
+		t.Fatalf("expected a challenge then an error, got %v", types)
+	}
+
+	if err := <-serverErr; !errors.Is(err, ErrSessionExpired) || ErrorCode(err) != message.CodeSessionExpired {
+		t.Fatalf("expected ErrSessionExpired, got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package authsocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/wallet"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/internal/wire"
+)
+
+// DefaultTicketTTL is how long a resumption ticket stays valid after it is
+// issued.
+const DefaultTicketTTL = 10 * time.Minute
+
+// TicketProtocol is the wallet protocol under which a server authenticates
+// the resumption tickets it issues, with an HMAC for itself keyed by the
+// session ID.
+var TicketProtocol = wallet.Protocol{
+	SecurityLevel: wallet.SecurityLevelEveryAppAndCounterparty,
+	Protocol:      "authsocket resumption ticket",
+}
+
+// ticket is the content of a resumption ticket. On the wire a ticket is
+// base64url(JSON content) "." base64url(HMAC), opaque to the client.
+type ticket struct {
+	ID          string `json:"id"`
+	SessionID   string `json:"sid"`
+	IdentityKey string `json:"identityKey"`
+	Expires     int64  `json:"exp"`
+}
+
+func ticketArgs(sessionID string) wallet.EncryptionArgs {
+	return wallet.EncryptionArgs{
+		ProtocolID:   TicketProtocol,
+		KeyID:        sessionID,
+		Counterparty: wallet.Counterparty{Type: wallet.CounterpartyTypeSelf},
+	}
+}
+
+// issueTicket creates a ticket for the client identityKey to resume the
+// session until expires.
+func issueTicket(ctx context.Context, w Wallet, sessionID, identityKey string, expires time.Time) (string, ticket, error) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	t := ticket{ID: hex.EncodeToString(id), SessionID: sessionID, IdentityKey: identityKey, Expires: expires.Unix()}
+	body, err := json.Marshal(t)
+	if err != nil {
+		return "", ticket{}, err
+	}
+	res, err := w.CreateHMAC(ctx, wallet.CreateHMACArgs{EncryptionArgs: ticketArgs(sessionID), Data: body}, "")
+	if err != nil {
+		return "", ticket{}, fmt.Errorf("%w: create ticket: %w", ErrWallet, err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(body) + "." + enc.EncodeToString(res.HMAC[:]), t, nil
+}
+
+// openTicket checks that raw was issued by w and has not expired, and
+// returns its content. Other tickets fail with ErrResumeRejected.
+func openTicket(ctx context.Context, w Wallet, raw string, now time.Time) (ticket, error) {
+	enc := base64.RawURLEncoding
+	bodyPart, macPart, ok := strings.Cut(raw, ".")
+	body, err := enc.DecodeString(bodyPart)
+	mac, merr := enc.DecodeString(macPart)
+	var t ticket
+	if !ok || err != nil || merr != nil || len(mac) != 32 || json.Unmarshal(body, &t) != nil {
+		return ticket{}, fmt.Errorf("%w: malformed ticket", ErrResumeRejected)
+	}
+	args := wallet.VerifyHMACArgs{EncryptionArgs: ticketArgs(t.SessionID), Data: body}
+	copy(args.HMAC[:], mac)
+	res, err := w.VerifyHMAC(ctx, args, "")
+	if err != nil || !res.Valid {
+		return ticket{}, fmt.Errorf("%w: ticket was not issued by this server", ErrResumeRejected)
+	}
+	if !now.Before(time.Unix(t.Expires, 0)) {
+		return ticket{}, fmt.Errorf("%w: ticket expired", ErrResumeRejected)
+	}
+	return t, nil
+}
+
+// sessionCache holds the sessions that can be resumed, by session ID, with
+// the one ticket currently valid for each. Expired entries are evicted when
+// a session is added, at most once a second.
+type sessionCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	sessions  map[string]resumable
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+type resumable struct {
+	session  *Session
+	ticketID string
+	expires  time.Time
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{ttl: ttl, sessions: make(map[string]resumable), now: time.Now}
+}
+
+// put makes session resumable with t, replacing any earlier ticket.
+func (c *sessionCache) put(session *Session, t ticket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := c.now(); !now.Before(c.nextSweep) {
+		for id, r := range c.sessions {
+			if !now.Before(r.expires) {
+				delete(c.sessions, id)
+			}
+		}
+		c.nextSweep = now.Add(sweepInterval)
+	}
+	c.sessions[session.ID] = resumable{session: session, ticketID: t.ID, expires: time.Unix(t.Expires, 0)}
+}
+
+// lookup returns the session t resumes, if t is still its current ticket.
+func (c *sessionCache) lookup(t ticket) (*Session, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.sessions[t.SessionID]
+	if !ok || r.ticketID != t.ID || !c.now().Before(r.expires) {
+		return nil, false
+	}
+	return r.session, true
+}
+
+// take consumes t, reporting false if it is no longer the current ticket.
+func (c *sessionCache) take(t ticket) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.sessions[t.SessionID]
+	if !ok || r.ticketID != t.ID {
+		return false
+	}
+	delete(c.sessions, t.SessionID)
+	return true
+}
+
+// issue issues the next ticket for session and makes it
+// resumable with it.
+func (c *sessionCache) issue(ctx context.Context, w Wallet, session *Session) (string, error) {
+	raw, t, err := issueTicket(ctx, w, session.ID, session.PeerIdentityKey, c.now().Add(c.ttl))
+	if err != nil {
+		return "", err
+	}
+	c.put(session, t)
+	return raw, nil
+}
+
+// HandleResume processes a resume message presenting a ticket from an
+// earlier handshake with this server, and returns the signed resumed reply,
+// carrying the next ticket, together with the session to continue. Tickets
+// that are unknown, expired, already used or not issued by this server fail
+// with ErrResumeRejected, after which the client may still send a hello.
+func (s *Server) HandleResume(ctx context.Context, raw []byte) ([]byte, *Session, error) {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if am.Type != message.TypeResume {
+		return nil, nil, unexpectedMessage(am.Type, message.TypeResume)
+	}
+	if s.tickets == nil {
+		return nil, nil, fmt.Errorf("%w: resumption is not enabled", ErrResumeRejected)
+	}
+	if len(am.Nonce) != 32 {
+		return nil, nil, fmt.Errorf("%w: resume nonce must be 32 bytes, got %d", ErrInvalidHandshake, len(am.Nonce))
+	}
+	t, err := openTicket(ctx, s.Wallet, am.Ticket, s.tickets.now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.IdentityKey != am.IdentityKey {
+		return nil, nil, fmt.Errorf("%w: ticket was issued to another identity", ErrResumeRejected)
+	}
+	session, ok := s.tickets.lookup(t)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: ticket is unknown or was already used", ErrResumeRejected)
+	}
+	if am.Version != session.Version {
+		return nil, nil, fmt.Errorf("%w: resume uses version %q, session has %q", ErrUnsupportedVersion, am.Version, session.Version)
+	}
+	s.identityKey = am.IdentityKey
+	preimage, err := wire.ResumePreimage(wire.RoleClient, session.ID, BytesFromIntArray(am.Nonce), am.Ticket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidHandshake, err)
+	}
+	if err := verifySignature(ctx, s.Wallet, am.IdentityKey, session.ID, preimage, am.Signature); err != nil {
+		return nil, nil, err
+	}
+	var claims map[string]interface{}
+	if s.Authorizer != nil {
+		if claims, err = s.authorize(ctx, session.Certificates); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !s.tickets.take(t) {
+		return nil, nil, fmt.Errorf("%w: ticket was already used", ErrResumeRejected)
+	}
+	// The session is only touched once the resume is sure to be accepted.
+	session.markAuthenticated()
+	if s.Authorizer != nil {
+		session.setClaims(claims)
+	}
+	next, err := s.tickets.issue(ctx, s.Wallet, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	preimage, err = wire.ResumePreimage(wire.RoleServer, session.ID, BytesFromIntArray(am.Nonce), next)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidHandshake, err)
+	}
+	sig, err := createSignature(ctx, s.Wallet, am.IdentityKey, session.ID, preimage)
+	if err != nil {
+		return nil, nil, err
+	}
+	reply, err := json.Marshal(message.AuthMessage{
+		Version:     session.Version,
+		Type:        message.TypeResumed,
+		IdentityKey: session.LocalIdentityKey,
+		YourNonce:   am.Nonce,
+		Ticket:      next,
+		Signature:   sig,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return reply, session, nil
+}
+
+// Resume returns a resume message presenting session's ticket, signed with
+// the wallet to prove the client still holds the session's identity key.
+func (c *Client) Resume(ctx context.Context, session *Session) ([]byte, error) {
+	c.identityKey = session.LocalIdentityKey
+	c.nonce = wire.MakeNonceIntArray()
+	preimage, err := wire.ResumePreimage(wire.RoleClient, session.ID, BytesFromIntArray(c.nonce), session.Ticket)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := createSignature(ctx, c.Wallet, session.PeerIdentityKey, session.ID, preimage)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(message.AuthMessage{
+		Version:     session.Version,
+		Type:        message.TypeResume,
+		IdentityKey: session.LocalIdentityKey,
+		Nonce:       c.nonce,
+		Ticket:      session.Ticket,
+		Signature:   sig,
+	})
+}
+
+// HandleResumed verifies the server's reply to Resume, which must be signed
+// by the session's server identity, and records the next ticket on session.
+// An error message from the server is returned as an error.
+func (c *Client) HandleResumed(ctx context.Context, raw []byte, session *Session) error {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return err
+	}
+	if am.Type == message.TypeError {
+		return remoteError(am)
+	}
+	if am.Type != message.TypeResumed {
+		return unexpectedMessage(am.Type, message.TypeResumed)
+	}
+	if !equalInts(am.YourNonce, c.nonce) {
+		return ErrNonceMismatch
+	}
+	if am.IdentityKey != session.PeerIdentityKey {
+		return fmt.Errorf("%w: resumed by %s", ErrServerIdentityMismatch, am.IdentityKey)
+	}
+	preimage, err := wire.ResumePreimage(wire.RoleServer, session.ID, BytesFromIntArray(c.nonce), am.Ticket)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidHandshake, err)
+	}
+	if err := verifySignature(ctx, c.Wallet, am.IdentityKey, session.ID, preimage, am.Signature); err != nil {
+		return err
+	}
+	session.Ticket = am.Ticket
+	return nil
+}
@@ -0,0 +1,249 @@
+package authsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+func TestResumeSession(t *testing.T) {
+	resumption := []ServerOption{WithResumption(time.Minute)}
+	ctx := context.Background()
+
+	client, server, clientErr, serverErr := runHandshakePair(t, nil, nil, resumption)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if client.Ticket == "" {
+		t.Fatal("expected a resumption ticket in ok")
+	}
+	first, err := client.Seal(ctx, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	oldTicket := client.Ticket
+	resumedClient, resumedServer, clientErr, serverErr := runHandshakePair(t, client, nil, resumption)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("resumption failed: client %v, server %v", clientErr, serverErr)
+	}
+	if resumedClient != client || resumedServer != server {
+		t.Fatal("expected resumption to continue the same sessions")
+	}
+	if client.Ticket == "" || client.Ticket == oldTicket {
+		t.Fatal("expected a fresh ticket after resumption")
+	}
+
+	// Sequence numbers carry on, so messages from before cannot be replayed.
+	if _, err := server.Open(ctx, first); !errors.Is(err, ErrReplayedMessage) {
+		t.Fatalf("expected ErrReplayedMessage, got %v", err)
+	}
+	second, err := client.Seal(ctx, []byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := server.Open(ctx, second); err != nil || string(payload) != "after" {
+		t.Fatalf("expected %q, got %q, %v", "after", payload, err)
+	}
+
+	// The old ticket was used up, so presenting it again falls back to a
+	// full handshake and a new session.
+	client.Ticket = oldTicket
+	fresh, _, clientErr, serverErr := runHandshakePair(t, client, nil, resumption)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if fresh == client || fresh.ID == client.ID {
+		t.Fatal("expected a used ticket to be rejected")
+	}
+}
+
+func TestResumeWithoutResumptionFallsBack(t *testing.T) {
+	client, _, clientErr, serverErr := runHandshakePair(t, nil, nil, []ServerOption{WithResumption(time.Minute)})
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+
+	// A server that does not share the resumable sessions rejects the ticket.
+	fresh, server, clientErr, serverErr := runHandshakePair(t, client, nil, nil)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if fresh == client || fresh.ID != server.ID {
+		t.Fatal("expected a full handshake")
+	}
+	if fresh.Ticket != "" {
+		t.Fatal("expected no ticket from a server without resumption")
+	}
+}
+
+func TestResumeRejectsForgedTicket(t *testing.T) {
+	resumption := []ServerOption{WithResumption(time.Minute)}
+	client, _, clientErr, serverErr := runHandshakePair(t, nil, nil, resumption)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+
+	client.Ticket = client.Ticket[:len(client.Ticket)-2] + "AA"
+	fresh, _, clientErr, serverErr := runHandshakePair(t, client, nil, resumption)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if fresh == client {
+		t.Fatal("expected a forged ticket to be rejected")
+	}
+}
+
+func TestAuthSocketClientReconnect(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair(), WithResumption(time.Minute))
+	got := make(chan string, 2)
+	server.On("ping", func(identityKey string, data interface{}) {
+		s, _ := data.(string)
+		got <- s
+	})
+
+	clientT, serverT := transport.InMemoryPair()
+	go server.AcceptClient(ctx, serverT)
+	client := NewAuthSocketClient(clientT, wallet)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, session, _ := client.conn()
+	sessionID := session.ID
+
+	clientT, serverT = transport.InMemoryPair()
+	go server.AcceptClient(ctx, serverT)
+	if err := client.Reconnect(ctx, clientT); err != nil {
+		t.Fatal(err)
+	}
+	if _, session, _ := client.conn(); session.ID != sessionID {
+		t.Fatal("expected the session to be resumed")
+	}
+	if err := client.Emit(ctx, "ping", "after reconnect"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-got:
+		if s != "after reconnect" {
+			t.Fatalf("server received %q", s)
+		}
+	case <-ctx.Done():
+		t.Fatal("server did not receive the event after reconnecting")
+	}
+}
+
+func TestAuthSocketClientReconnectOnDisconnect(t *testing.T) {
+	wallet, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewAuthSocketServer(nil, demoKeypair(), WithResumption(time.Minute))
+	got := make(chan string, 256)
+	server.On("ping", func(identityKey string, data interface{}) {
+		s, _ := data.(string)
+		got <- s
+	})
+	srv := httptest.NewServer(server.Handler())
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	clientT, err := transport.NewWebSocketClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewAuthSocketClient(clientT, wallet)
+	reconnected := make(chan error, 1)
+	client.OnDisconnect(func(error) {
+		if err := client.Emit(ctx, "ping", "while down"); !errors.Is(err, ErrNotConnected) {
+			reconnected <- fmt.Errorf("expected ErrNotConnected while disconnected, got %v", err)
+			return
+		}
+		next, err := transport.NewWebSocketClient(url)
+		if err == nil {
+			err = client.Reconnect(ctx, next)
+		}
+		reconnected <- err
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Emit keeps running across the disconnect and the reconnect.
+	emitting, stop := context.WithCancel(ctx)
+	defer stop()
+	go func() {
+		for emitting.Err() == nil {
+			client.Emit(emitting, "ping", "busy")
+		}
+	}()
+	clientT.(*transport.WebSocketTransport).Close()
+	if err := <-reconnected; err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	if err := client.Emit(ctx, "ping", "after reconnect"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case s := <-got:
+			if s == "after reconnect" {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("server did not receive the event after reconnecting")
+		}
+	}
+}
+
+func TestResumeDeniedLeavesSessionUntouched(t *testing.T) {
+	var denied atomic.Bool
+	options := []ServerOption{
+		WithResumption(time.Minute),
+		WithAuthorizer(AuthorizerFunc(func(context.Context, AuthorizationRequest) (Decision, error) {
+			if denied.Load() {
+				return Deny("key revoked"), nil
+			}
+			return Allow(map[string]interface{}{"role": "admin"}), nil
+		})),
+	}
+	client, server, clientErr, serverErr := runHandshakePair(t, nil, nil, options)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	authenticated := server.AuthenticatedAt()
+
+	denied.Store(true)
+	time.Sleep(10 * time.Millisecond)
+	if _, _, _, err := runHandshakePair(t, client, nil, options); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	if !server.AuthenticatedAt().Equal(authenticated) {
+		t.Fatal("a denied resume renewed the session")
+	}
+	if server.Claims()["role"] != "admin" {
+		t.Fatalf("a denied resume changed the claims to %v", server.Claims())
+	}
+}
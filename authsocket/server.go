@@ -1,38 +1,263 @@
 package authsocket
 
 import (
-    "encoding/json"
-    "fmt"
-    "github.com/sirdeggen/go-authsocket/internal/wire"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/internal/wire"
 )
 
-type Server struct{}
-
-func NewServer() *Server { return &Server{} }
-
-// HandleHello processes a Hello message (AuthMessage JSON) and responds with a nonce as number[] payload
-func (s *Server) HandleHello(raw []byte) ([]byte, error) {
-    var am wire.AuthMessage
-    if err := json.Unmarshal(raw, &am); err != nil {
-        return nil, err
-    }
-    if am.Type != "hello" {
-        return nil, fmt.Errorf("unexpected message type: %s", am.Type)
-    }
-    nonce := wire.MakeNonceIntArray()
-    resp := wire.AuthMessage{Version: "1", Type: "nonce", Payload: nonce}
-    return json.Marshal(resp)
-}
-
-// HandleAuth processes an Auth message and returns an OK message on success
-func (s *Server) HandleAuth(raw []byte) ([]byte, error) {
-    var am wire.AuthMessage
-    if err := json.Unmarshal(raw, &am); err != nil {
-        return nil, err
-    }
-    if am.Type != "auth" {
-        return nil, fmt.Errorf("unexpected message type: %s", am.Type)
-    }
-    ok := wire.AuthMessage{Version: "1", Type: "ok"}
-    return json.Marshal(ok)
+// Server holds the state of a single server-side handshake: the identity key
+// and nonce announced in the client's hello and the nonce issued in reply.
+// Issued nonces are also recorded in Nonces, which may be shared between
+// servers, so that each can be redeemed only once and only before NonceTTL.
+type Server struct {
+	Wallet   Wallet
+	Nonces   NonceStore
+	NonceTTL time.Duration
+	// RequestedCertificates, when set, is sent with the nonce and the client
+	// must answer with matching certificates.
+	RequestedCertificates *CertificateRequest
+	// Authorizer, when set, decides whether a verified client may proceed.
+	Authorizer Authorizer
+	// Metadata describes the connection and is passed to Authorizer.
+	Metadata map[string]string
+	// Versions lists the protocol versions the server accepts, most preferred
+	// first; when empty, SupportedVersions is accepted.
+	Versions []string
+	// Features lists the optional features the server supports.
+	Features []string
+	// Origin is the server's own origin, covered by both handshake
+	// signatures. Clients must be configured with the same origin.
+	Origin string
+
+	localKey        string
+	version         string
+	features        []string
+	offeredVersions []string
+	offeredFeatures []string
+	identityKey     string
+	clientNonce     []int
+	nonce           []int
+	certificates    []Certificate
+	claims          map[string]interface{}
+	tickets         *sessionCache
+	ticket          ticket
+}
+
+func NewServer(w Wallet) *Server {
+	return &Server{Wallet: w, Nonces: NewMemoryNonceStore(), NonceTTL: DefaultNonceTTL}
+}
+
+// HandleHello processes a Hello message (AuthMessage JSON) and responds with
+// a nonce as number[] payload. The server selects its most preferred version
+// among those the client offered, failing with ErrUnsupportedVersion if there
+// is none, and the features both sides support. The nonce message carries
+// them, the client's nonce, the server's identity key and a signature over
+// the handshake preimage, so the client can authenticate the server.
+func (s *Server) HandleHello(ctx context.Context, raw []byte) ([]byte, error) {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	if am.Type != message.TypeHello {
+		return nil, unexpectedMessage(am.Type, message.TypeHello)
+	}
+	if am.IdentityKey == "" {
+		return nil, fmt.Errorf("%w: hello missing identityKey", ErrInvalidHandshake)
+	}
+	if len(am.Nonce) != 32 {
+		return nil, fmt.Errorf("%w: hello nonce must be 32 bytes, got %d", ErrInvalidHandshake, len(am.Nonce))
+	}
+	offered := am.SupportedVersions
+	if len(offered) == 0 {
+		offered = []string{am.Version}
+	}
+	version, ok := selectVersion(s.versions(), offered)
+	if !ok {
+		return nil, fmt.Errorf("%w: client offered %v, server accepts %v", ErrUnsupportedVersion, offered, s.versions())
+	}
+	localKey, err := identityKey(ctx, s.Wallet)
+	if err != nil {
+		return nil, err
+	}
+	nonce := wire.MakeNonceIntArray()
+	features := intersect(am.Features, s.Features)
+	preimage, err := wire.HandshakePreimage(wire.HandshakeParams{
+		Role:              wire.RoleServer,
+		Version:           version,
+		Features:          features,
+		OfferedVersions:   am.SupportedVersions,
+		OfferedFeatures:   am.Features,
+		Origin:            wire.NormalizeOrigin(s.Origin),
+		ClientNonce:       BytesFromIntArray(am.Nonce),
+		ServerNonce:       BytesFromIntArray(nonce),
+		ClientIdentityKey: am.IdentityKey,
+		ServerIdentityKey: localKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHandshake, err)
+	}
+	keyID := wire.SessionID(BytesFromIntArray(am.Nonce), BytesFromIntArray(nonce))
+	sig, err := createSignature(ctx, s.Wallet, am.IdentityKey, keyID, preimage)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Nonces.Issue(ctx, hex.EncodeToString(BytesFromIntArray(nonce)), time.Now().Add(s.NonceTTL)); err != nil {
+		return nil, fmt.Errorf("issue nonce: %w", err)
+	}
+	s.localKey = localKey
+	s.version = version
+	s.features = features
+	s.offeredVersions = am.SupportedVersions
+	s.offeredFeatures = am.Features
+	s.identityKey = am.IdentityKey
+	s.clientNonce = am.Nonce
+	s.nonce = nonce
+	resp := message.AuthMessage{
+		Version:     s.version,
+		Type:        message.TypeNonce,
+		IdentityKey: s.localKey,
+		YourNonce:   am.Nonce,
+		Payload:     nonce,
+		Signature:   sig,
+		Features:    s.features,
+
+		RequestedCertificates: s.RequestedCertificates,
+	}
+	return json.Marshal(resp)
+}
+
+// HandleAuth processes an Auth message and returns an OK message on success.
+// The message must come from the identity announced in the hello, carry both
+// nonces of this handshake, and be signed over them and both identity keys by
+// the client's identity key. The server nonce is then redeemed from Nonces, so a
+// replayed or expired auth fails with ErrNonceUnknown. If certificates were
+// requested, those presented are verified and their revealed fields decrypted.
+// Finally the Authorizer, if any, may deny the client with ErrUnauthorized.
+func (s *Server) HandleAuth(ctx context.Context, raw []byte) ([]byte, error) {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	if am.Type == message.TypeError {
+		return nil, remoteError(am)
+	}
+	if am.Type != message.TypeAuth {
+		return nil, unexpectedMessage(am.Type, message.TypeAuth)
+	}
+	if s.nonce == nil {
+		return nil, fmt.Errorf("%w: auth before hello", ErrInvalidHandshake)
+	}
+	if am.Version != s.version {
+		return nil, fmt.Errorf("%w: auth uses version %q, negotiated %q", ErrUnsupportedVersion, am.Version, s.version)
+	}
+	if am.IdentityKey != s.identityKey {
+		return nil, ErrIdentityMismatch
+	}
+	if !equalInts(am.Payload, s.nonce) || !equalInts(am.Nonce, s.clientNonce) {
+		return nil, ErrNonceMismatch
+	}
+	preimage, err := wire.HandshakePreimage(wire.HandshakeParams{
+		Role:              wire.RoleClient,
+		Version:           s.version,
+		Features:          s.features,
+		OfferedVersions:   s.offeredVersions,
+		OfferedFeatures:   s.offeredFeatures,
+		Origin:            wire.NormalizeOrigin(s.Origin),
+		ClientNonce:       BytesFromIntArray(s.clientNonce),
+		ServerNonce:       BytesFromIntArray(s.nonce),
+		ClientIdentityKey: s.identityKey,
+		ServerIdentityKey: s.localKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHandshake, err)
+	}
+	if err := verifySignature(ctx, s.Wallet, am.IdentityKey, s.SessionID(), preimage, am.Signature); err != nil {
+		return nil, err
+	}
+	if err := s.Nonces.Redeem(ctx, hex.EncodeToString(BytesFromIntArray(s.nonce))); err != nil {
+		return nil, err
+	}
+	if s.RequestedCertificates != nil {
+		certs, err := verifyCertificates(ctx, s.Wallet, s.RequestedCertificates, s.identityKey, am.Certificates)
+		if err != nil {
+			return nil, err
+		}
+		s.certificates = certs
+	}
+	if s.Authorizer != nil {
+		claims, err := s.authorize(ctx, s.certificates)
+		if err != nil {
+			return nil, err
+		}
+		s.claims = claims
+	}
+	ok := message.AuthMessage{Version: s.version, Type: message.TypeOK}
+	if s.tickets != nil {
+		raw, t, err := issueTicket(ctx, s.Wallet, s.SessionID(), s.identityKey, s.tickets.now().Add(s.tickets.ttl))
+		if err != nil {
+			return nil, err
+		}
+		ok.Ticket = raw
+		s.ticket = t
+	}
+	return json.Marshal(ok)
+}
+
+// authorize consults the Authorizer about the client and returns the claims
+// it attached, or ErrUnauthorized if it denied the client.
+func (s *Server) authorize(ctx context.Context, certs []Certificate) (map[string]interface{}, error) {
+	return authorize(ctx, s.Authorizer, AuthorizationRequest{
+		IdentityKey:  s.identityKey,
+		Certificates: certs,
+		Metadata:     s.Metadata,
+	})
+}
+
+// authorize consults a about req and returns the claims it attached, or
+// ErrUnauthorized if it denied the client.
+func authorize(ctx context.Context, a Authorizer, req AuthorizationRequest) (map[string]interface{}, error) {
+	decision, err := a.Authorize(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("authorize: %w", err)
+	}
+	if !decision.Allow {
+		if decision.Reason == "" {
+			return nil, ErrUnauthorized
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnauthorized, decision.Reason)
+	}
+	return decision.Claims, nil
+}
+
+// SessionID returns the identifier shared with the client, derived from both
+// nonces, or "" before HandleHello has succeeded.
+func (s *Server) SessionID() string {
+	if s.nonce == nil {
+		return ""
+	}
+	return wire.SessionID(BytesFromIntArray(s.clientNonce), BytesFromIntArray(s.nonce))
+}
+
+func (s *Server) versions() []string {
+	if len(s.Versions) == 0 {
+		return SupportedVersions
+	}
+	return s.Versions
+}
+
+// Certificates returns the verified certificates the client presented, or
+// nil if none were requested.
+func (s *Server) Certificates() []Certificate {
+	return s.certificates
+}
+
+// Claims returns the claims the Authorizer attached to the client, if any.
+func (s *Server) Claims() map[string]interface{} {
+	return s.claims
 }
@@ -0,0 +1,249 @@
+package authsocket
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+	"github.com/sirdeggen/go-authsocket/internal/wire"
+)
+
+// ReplayWindow is how many sequence numbers behind the highest one received
+// a session still accepts, to tolerate reordering by retrying transports.
+const ReplayWindow = 64
+
+// Session describes the outcome of a successful handshake and protects the
+// general messages exchanged afterwards. Payloads are encrypted with AES-GCM
+// under a key both sides derive from their identity keys and the session
+// nonces. Each direction numbers its messages from 1; the sequence number is
+// carried in the message and covered by its signature, and the receiver
+// accepts each number at most once.
+type Session struct {
+	// ID is shared by both sides and derived from the client and server nonces.
+	ID string
+	// Version is the protocol version negotiated in the handshake.
+	Version string
+	// Features lists the optional features both sides support.
+	Features []string
+	// LocalIdentityKey is this side's compressed identity key in hex.
+	LocalIdentityKey string
+	// PeerIdentityKey is the counterparty's identity key, proven by its
+	// signature during the handshake.
+	PeerIdentityKey string
+	// Certificates holds the verified certificates the client presented. It is
+	// only populated on the server side, when certificates were requested.
+	Certificates []Certificate
+	// Ticket, on the client side, is the latest resumption ticket the server
+	// issued for the session, or "" if the server does not offer resumption.
+	Ticket string
+
+	wallet Wallet
+	aead   cipher.AEAD
+	// buffered holds general messages received before the handshake completed.
+	buffered [][]byte
+
+	authMu          sync.Mutex
+	authenticatedAt time.Time
+	challenge       []int
+	claims          map[string]interface{}
+
+	sendMu  sync.Mutex
+	sendSeq uint64
+	recvMu  sync.Mutex
+	recvMax uint64
+	// recvSeen has bit i set when sequence number recvMax-i has been accepted.
+	recvSeen uint64
+}
+
+func newSession(ctx context.Context, wallet Wallet, localIdentityKey, peerIdentityKey string, clientNonce, serverNonce []byte) (*Session, error) {
+	id := wire.SessionID(clientNonce, serverNonce)
+	key, err := deriveSessionKey(ctx, wallet, peerIdentityKey, id, append(append([]byte{}, clientNonce...), serverNonce...))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		ID:               id,
+		LocalIdentityKey: localIdentityKey,
+		PeerIdentityKey:  peerIdentityKey,
+		wallet:           wallet,
+		aead:             aead,
+		authenticatedAt:  time.Now(),
+	}, nil
+}
+
+// Seal encrypts payload and wraps the ciphertext in a general message signed
+// over the session ID, the next sequence number and the ciphertext. Sealed
+// messages should reach the peer roughly in the order they were sealed; see
+// ReplayWindow.
+func (s *Session) Seal(ctx context.Context, payload []byte) ([]byte, error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.sealLocked(ctx, payload)
+}
+
+func (s *Session) sealLocked(ctx context.Context, payload []byte) ([]byte, error) {
+	seq := s.sendSeq + 1
+	ciphertext, err := s.encrypt(seq, payload)
+	if err != nil {
+		return nil, err
+	}
+	preimage, err := wire.MessagePreimage(s.ID, seq, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := createSignature(ctx, s.wallet, s.PeerIdentityKey, s.ID, preimage)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(message.AuthMessage{
+		Version:     s.Version,
+		Type:        message.TypeGeneral,
+		IdentityKey: s.LocalIdentityKey,
+		Seq:         seq,
+		Payload:     IntsFromBytes(ciphertext),
+		Signature:   sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.sendSeq = seq
+	return raw, nil
+}
+
+// Buffered returns the general messages the peer sent before the handshake
+// completed, in arrival order, and forgets them. Each should be passed to Open
+// before any message received afterwards.
+func (s *Session) Buffered() [][]byte {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	b := s.buffered
+	s.buffered = nil
+	return b
+}
+
+// Open verifies a general message from the peer and returns its decrypted
+// payload. Payloads that fail to decrypt are rejected with ErrDecryption.
+// Sequence numbers already accepted fail with ErrReplayedMessage; ones more
+// than ReplayWindow behind or ahead of the highest accepted number fail with
+// ErrMessageOutOfWindow. Rejected messages leave the window unchanged.
+func (s *Session) Open(ctx context.Context, raw []byte) ([]byte, error) {
+	am, err := decodeMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	if am.Type != message.TypeGeneral {
+		return nil, unexpectedMessage(am.Type, message.TypeGeneral)
+	}
+	if am.Version != s.Version {
+		return nil, fmt.Errorf("%w: message uses version %q, negotiated %q", ErrUnsupportedVersion, am.Version, s.Version)
+	}
+	if am.IdentityKey != s.PeerIdentityKey {
+		return nil, ErrIdentityMismatch
+	}
+
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if err := s.checkSeqLocked(am.Seq); err != nil {
+		return nil, err
+	}
+	ciphertext := BytesFromIntArray(am.Payload)
+	preimage, err := wire.MessagePreimage(s.ID, am.Seq, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(ctx, s.wallet, s.PeerIdentityKey, s.ID, preimage, am.Signature); err != nil {
+		return nil, err
+	}
+	payload, err := s.decrypt(am.Seq, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.acceptSeqLocked(am.Seq)
+	return payload, nil
+}
+
+// encrypt returns nonce || AES-GCM(payload), authenticating the session ID and
+// seq as additional data.
+func (s *Session) encrypt(seq uint64, payload []byte) ([]byte, error) {
+	aad, err := wire.MessagePreimage(s.ID, seq, nil)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(payload)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, payload, aad), nil
+}
+
+func (s *Session) decrypt(seq uint64, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < s.aead.NonceSize()+s.aead.Overhead() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecryption)
+	}
+	aad, err := wire.MessagePreimage(s.ID, seq, nil)
+	if err != nil {
+		return nil, err
+	}
+	nonce, sealed := ciphertext[:s.aead.NonceSize()], ciphertext[s.aead.NonceSize():]
+	payload, err := s.aead.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+	return payload, nil
+}
+
+func (s *Session) checkSeqLocked(seq uint64) error {
+	switch {
+	case seq == 0:
+		return fmt.Errorf("%w: missing sequence number", ErrMessageOutOfWindow)
+	case seq > s.recvMax+ReplayWindow:
+		return fmt.Errorf("%w: seq %d is too far ahead of %d", ErrMessageOutOfWindow, seq, s.recvMax)
+	case seq > s.recvMax:
+		return nil
+	case s.recvMax-seq >= ReplayWindow:
+		return fmt.Errorf("%w: seq %d is too far behind %d", ErrMessageOutOfWindow, seq, s.recvMax)
+	case s.recvSeen&(1<<(s.recvMax-seq)) != 0:
+		return fmt.Errorf("%w: seq %d", ErrReplayedMessage, seq)
+	}
+	return nil
+}
+
+func (s *Session) acceptSeqLocked(seq uint64) {
+	if seq > s.recvMax {
+		shift := seq - s.recvMax
+		if shift >= ReplayWindow {
+			s.recvSeen = 0
+		} else {
+			s.recvSeen <<= shift
+		}
+		s.recvMax = seq
+	}
+	s.recvSeen |= 1 << (s.recvMax - seq)
+}
+
+// send seals payload and sends it while holding the send lock, so the order
+// on the wire always matches the counter order.
+func (s *Session) send(ctx context.Context, t transport.Transport, payload []byte) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	raw, err := s.sealLocked(ctx, payload)
+	if err != nil {
+		return err
+	}
+	return t.Send(ctx, raw)
+}
@@ -0,0 +1,235 @@
+package authsocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	w "github.com/sirdeggen/go-authsocket/internal/wire"
+)
+
+// sessionPair returns the client and server views of one session.
+func sessionPair(t *testing.T) (*Session, *Session) {
+	t.Helper()
+	clientKey, err := identity.FromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKey := demoKeypair()
+	clientNonce, serverNonce := BytesFromIntArray(w.MakeNonceIntArray()), BytesFromIntArray(w.MakeNonceIntArray())
+	ctx := context.Background()
+	client, err := newSession(ctx, clientKey, clientKey.PubHex(), serverKey.PubHex(), clientNonce, serverNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := newSession(ctx, serverKey, serverKey.PubHex(), clientKey.PubHex(), clientNonce, serverNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Version, server.Version = message.Version, message.Version
+	return client, server
+}
+
+func TestSessionSealOpen(t *testing.T) {
+	client, server := sessionPair(t)
+
+	for i, msg := range []string{"first", "second", "third"} {
+		raw, err := client.Seal(context.Background(), []byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := server.Open(context.Background(), raw)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if string(payload) != msg {
+			t.Fatalf("message %d: got %q, want %q", i, payload, msg)
+		}
+	}
+}
+
+func TestSessionOpenRejectsForgedMessage(t *testing.T) {
+	client, server := sessionPair(t)
+	attacker, err := identity.FromHex("02030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed by the wrong key but claiming the client's identity
+	preimage, err := w.MessagePreimage(client.ID, 1, []byte("forged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := createSignature(context.Background(), attacker, server.LocalIdentityKey, client.ID, preimage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := json.Marshal(message.AuthMessage{
+		Version:     "1",
+		Type:        "general",
+		IdentityKey: client.LocalIdentityKey,
+		Seq:         1,
+		Payload:     IntsFromBytes([]byte("forged")),
+		Signature:   sig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(context.Background(), forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	// A forged message must not consume the sequence number of a genuine one
+	raw, err := client.Seal(context.Background(), []byte("genuine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(context.Background(), raw); err != nil {
+		t.Fatalf("genuine message after forgery: %v", err)
+	}
+}
+
+func TestSessionOpenRejectsReplayedMessage(t *testing.T) {
+	client, server := sessionPair(t)
+
+	raw, err := client.Seal(context.Background(), []byte("once"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(context.Background(), raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(context.Background(), raw); !errors.Is(err, ErrReplayedMessage) {
+		t.Fatalf("expected ErrReplayedMessage on replay, got %v", err)
+	}
+}
+
+func TestSessionOpenAcceptsReorderWithinWindow(t *testing.T) {
+	client, server := sessionPair(t)
+
+	var sealed [][]byte
+	for i := 0; i < 3; i++ {
+		raw, err := client.Seal(context.Background(), []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed = append(sealed, raw)
+	}
+	for _, i := range []int{2, 0, 1} {
+		payload, err := server.Open(context.Background(), sealed[i])
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if payload[0] != byte(i) {
+			t.Fatalf("message %d: got payload %v", i, payload)
+		}
+	}
+	if _, err := server.Open(context.Background(), sealed[0]); !errors.Is(err, ErrReplayedMessage) {
+		t.Fatalf("expected ErrReplayedMessage, got %v", err)
+	}
+}
+
+func TestSessionOpenRejectsOutOfWindow(t *testing.T) {
+	client, server := sessionPair(t)
+
+	stale, err := client.Seal(context.Background(), []byte("stale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < ReplayWindow; i++ {
+		raw, err := client.Seal(context.Background(), []byte("filler"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.Open(context.Background(), raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := server.Open(context.Background(), stale); !errors.Is(err, ErrMessageOutOfWindow) {
+		t.Fatalf("expected ErrMessageOutOfWindow for stale message, got %v", err)
+	}
+
+	// Jumping far ahead of the highest accepted number is rejected too
+	for i := 0; i < ReplayWindow; i++ {
+		if _, err := client.Seal(context.Background(), []byte("lost")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ahead, err := client.Seal(context.Background(), []byte("ahead"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(context.Background(), ahead); !errors.Is(err, ErrMessageOutOfWindow) {
+		t.Fatalf("expected ErrMessageOutOfWindow for message ahead of window, got %v", err)
+	}
+}
+
+func TestSessionOpenRejectsMessageFromOtherSession(t *testing.T) {
+	client, _ := sessionPair(t)
+	_, otherServer := sessionPair(t)
+
+	raw, err := client.Seal(context.Background(), []byte("wrong session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := otherServer.Open(context.Background(), raw); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestSessionPayloadIsEncrypted(t *testing.T) {
+	client, server := sessionPair(t)
+	secret := []byte("the eagle lands at midnight")
+
+	raw, err := client.Seal(context.Background(), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var am message.AuthMessage
+	if err := json.Unmarshal(raw, &am); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(BytesFromIntArray(am.Payload), secret) {
+		t.Fatal("general message payload carries the plaintext")
+	}
+	payload, err := server.Open(context.Background(), raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, secret) {
+		t.Fatalf("got %q, want %q", payload, secret)
+	}
+}
+
+func TestSessionOpenRejectsUndecryptablePayload(t *testing.T) {
+	client, server := sessionPair(t)
+
+	// Correctly signed by the client, but not encrypted under the session key
+	garbage := bytes.Repeat([]byte{0x42}, 64)
+	preimage, err := w.MessagePreimage(client.ID, 1, garbage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := createSignature(context.Background(), client.wallet, client.PeerIdentityKey, client.ID, preimage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(message.AuthMessage{
+		Version:     "1",
+		Type:        "general",
+		IdentityKey: client.LocalIdentityKey,
+		Seq:         1,
+		Payload:     IntsFromBytes(garbage),
+		Signature:   sig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Open(context.Background(), raw); !errors.Is(err, ErrDecryption) {
+		t.Fatalf("expected ErrDecryption, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package authsocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+// blockingTransport ignores the context in Receive and only returns once it
+// is closed, like a connection without read deadlines.
+type blockingTransport struct {
+	transport.Transport
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newBlockingTransport(t transport.Transport) *blockingTransport {
+	return &blockingTransport{Transport: t, closed: make(chan struct{})}
+}
+
+func (b *blockingTransport) Receive(ctx context.Context) ([]byte, error) {
+	<-b.closed
+	return nil, transport.ErrClosed
+}
+
+func (b *blockingTransport) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+func TestAcceptClientHelloTimeout(t *testing.T) {
+	_, serverT := transport.InMemoryPair()
+	conn := newBlockingTransport(serverT)
+	server := NewAuthSocketServer(nil, demoKeypair(), WithHelloTimeout(50*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() { done <- server.AcceptClient(context.Background(), conn) }()
+
+	select {
+	case err := <-done:
+		var he *HandshakeError
+		if !errors.As(err, &he) || he.Stage != StageHello || !errors.Is(err, ErrHandshakeTimeout) {
+			t.Fatalf("expected hello timeout, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handshake did not time out")
+	}
+	if got := server.HandshakeTimeouts(); got != 1 {
+		t.Fatalf("expected 1 counted timeout, got %d", got)
+	}
+}
+
+func TestServerHandshakeAuthTimeout(t *testing.T) {
+	clientT, serverT := transport.InMemoryPair()
+	ctx := context.Background()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		_, err := RunServerHandshake(ctx, serverT, demoKeypair(), WithAuthTimeout(50*time.Millisecond))
+		serverErr <- err
+	}()
+
+	// Send a hello and read the nonce, but never answer it.
+	hello, err := NewClient(demoKeypair()).Hello(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clientT.Send(ctx, hello); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientT.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	err = <-serverErr
+	var he *HandshakeError
+	if !errors.As(err, &he) || he.Stage != StageAuth || !errors.Is(err, ErrHandshakeTimeout) {
+		t.Fatalf("expected auth timeout, got %v", err)
+	}
+	if ErrorCode(err) != message.CodeHandshakeTimeout {
+		t.Fatalf("expected code handshake_timeout, got %s", ErrorCode(err))
+	}
+}
+
+func TestServerHandshakeTotalTimeout(t *testing.T) {
+	_, serverT := transport.InMemoryPair()
+	start := time.Now()
+	_, err := RunServerHandshake(context.Background(), serverT, demoKeypair(),
+		WithHelloTimeout(0), WithHandshakeTimeout(50*time.Millisecond))
+	if !errors.Is(err, ErrHandshakeTimeout) {
+		t.Fatalf("expected handshake timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("handshake deadline not enforced, took %s", elapsed)
+	}
+}
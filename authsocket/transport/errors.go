@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport failures. Transports wrap their underlying errors in these where
+// they apply; a Receive or Send cut short by its context returns the
+// context's error instead, wrapped in ErrTimeout if its deadline passed.
+var (
+	ErrClosed  = errors.New("transport closed")
+	ErrTimeout = errors.New("transport timed out")
+	// ErrMessageTooLarge is returned by Receive when the peer sends a message
+	// over the transport's read limit. The connection is closed.
+	ErrMessageTooLarge = errors.New("message exceeds read limit")
+	// ErrPeerDead is returned by Receive when the peer stopped answering
+	// keepalive pings. It is always wrapped together with ErrClosed, as the
+	// transport closes the connection.
+	ErrPeerDead = errors.New("peer not responding")
+)
+
+// wsError classifies an error from a WebSocket connection.
+func wsError(err error) error {
+	var ce *websocket.CloseError
+	var ne net.Error
+	switch {
+	case errors.Is(err, websocket.ErrReadLimit):
+		return fmt.Errorf("%w: %w", ErrMessageTooLarge, err)
+	case errors.As(err, &ce), errors.Is(err, net.ErrClosed), errors.Is(err, websocket.ErrCloseSent),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	case errors.As(err, &ne) && ne.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// contextError returns the error for an operation cut short by ctx.
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	}
+	return ctx.Err()
+}
+
+// peerDead returns the error for a peer silent for longer than silence.
+func peerDead(silence time.Duration, err error) error {
+	return fmt.Errorf("%w: %w: nothing received for %s: %w", ErrClosed, ErrPeerDead, silence, err)
+}
@@ -9,6 +9,12 @@ type Transport interface {
 	Receive(ctx context.Context) ([]byte, error)
 }
 
+// MetadataProvider is implemented by transports that can describe their
+// connection, such as its remote address, for authorization decisions.
+type MetadataProvider interface {
+	Metadata() map[string]string
+}
+
 type inMemoryClient struct {
 	toServer   chan []byte
 	fromServer chan []byte
@@ -34,7 +40,7 @@ func (c *inMemoryClient) Send(ctx context.Context, data []byte) error {
 	case c.toServer <- data:
 		return nil
 	case <-ctx.Done():
-		return ctx.Err()
+		return contextError(ctx)
 	}
 }
 
@@ -43,7 +49,7 @@ func (c *inMemoryClient) Receive(ctx context.Context) ([]byte, error) {
 	case v := <-c.fromServer:
 		return v, nil
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, contextError(ctx)
 	}
 }
 
@@ -52,7 +58,7 @@ func (s *inMemoryServer) Send(ctx context.Context, data []byte) error {
 	case s.toClient <- data:
 		return nil
 	case <-ctx.Done():
-		return ctx.Err()
+		return contextError(ctx)
 	}
 }
 
@@ -61,6 +67,6 @@ func (s *inMemoryServer) Receive(ctx context.Context) ([]byte, error) {
 	case v := <-s.fromClient:
 		return v, nil
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, contextError(ctx)
 	}
 }
@@ -0,0 +1,480 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SocketIOEvent is the Socket.IO event that carries AuthMessages, as used by
+// the TypeScript authsocket and authsocket-client.
+const SocketIOEvent = "authMessage"
+
+// socketIOConnectTimeout bounds the wait for a client to join the default
+// namespace after the Engine.IO handshake, as socket.io's connectTimeout.
+const socketIOConnectTimeout = 45 * time.Second
+
+// ErrSocketIOProtocol is returned when the peer does not follow Engine.IO v4
+// or the Socket.IO protocol.
+var ErrSocketIOProtocol = errors.New("socket.io protocol error")
+
+// Engine.IO v4 packet types.
+const (
+	eioOpen    = '0'
+	eioClose   = '1'
+	eioPing    = '2'
+	eioPong    = '3'
+	eioMessage = '4'
+)
+
+// Socket.IO packet types, carried in Engine.IO message packets.
+const (
+	sioConnect      = '0'
+	sioDisconnect   = '1'
+	sioEvent        = '2'
+	sioConnectError = '4'
+)
+
+// eioOpenPacket is the payload of the Engine.IO open packet.
+type eioOpenPacket struct {
+	SID          string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int64    `json:"pingInterval"`
+	PingTimeout  int64    `json:"pingTimeout"`
+	MaxPayload   int64    `json:"maxPayload"`
+}
+
+// SocketIOTransport implements Transport over Socket.IO on Engine.IO v4 with
+// the WebSocket transport, so Go peers can talk to the TypeScript authsocket
+// packages. Each AuthMessage is sent as the single argument of an
+// SocketIOEvent event on the default namespace; other events are ignored.
+// Only WebSocket connections are supported, so socket.io clients must be
+// created with transports: ["websocket"].
+//
+// A reader goroutine answers the server's pings and queues events for
+// Receive, so Send and Receive can be used concurrently. The connection is
+// closed when the peer has been silent for longer than the ping interval and
+// timeout together.
+type SocketIOTransport struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	info    map[string]string
+
+	incoming  chan []byte
+	done      chan struct{} // closed when the reader stops
+	err       error         // why the reader stopped, set before done is closed
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSocketIOClient connects to the Socket.IO server at rawURL, such as
+// "https://example.com" or "ws://localhost:8080", and joins the default
+// namespace. The path defaults to "/socket.io/".
+func NewSocketIOClient(rawURL string) (Transport, error) {
+	target, err := socketIOURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = 5 * time.Second
+	conn, _, err := dialer.Dial(target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial socket.io: %w", err)
+	}
+	t, err := clientSocketIOHandshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// socketIOURL returns the Engine.IO WebSocket URL for a server URL.
+func socketIOURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parse socket.io url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("parse socket.io url: unsupported scheme %q", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/socket.io/"
+	}
+	q := u.Query()
+	q.Set("EIO", "4")
+	q.Set("transport", "websocket")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// clientSocketIOHandshake reads the Engine.IO open packet and joins the
+// default namespace.
+func clientSocketIOHandshake(conn *websocket.Conn) (*SocketIOTransport, error) {
+	deadline := time.Now().Add(5 * time.Second)
+	conn.SetReadDeadline(deadline)
+	conn.SetWriteDeadline(deadline)
+
+	frame, err := readTextFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	var open eioOpenPacket
+	if len(frame) == 0 || frame[0] != eioOpen || json.Unmarshal(frame[1:], &open) != nil {
+		return nil, fmt.Errorf("%w: expected an open packet, got %q", ErrSocketIOProtocol, frame)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte{eioMessage, sioConnect}); err != nil {
+		return nil, wsError(err)
+	}
+	for {
+		frame, err := readTextFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) < 2 || frame[0] != eioMessage {
+			continue
+		}
+		nsp, rest := splitNamespace(frame[2:])
+		if nsp != "/" {
+			continue
+		}
+		switch frame[1] {
+		case sioConnect:
+			var ack struct {
+				SID string `json:"sid"`
+			}
+			json.Unmarshal(rest, &ack)
+			info := map[string]string{"sid": ack.SID}
+			t := newSocketIOTransport(conn, info)
+			go t.readLoop(socketIOSilence(open), false)
+			return t, nil
+		case sioConnectError:
+			return nil, fmt.Errorf("%w: connection refused: %s", ErrSocketIOProtocol, rest)
+		}
+	}
+}
+
+// socketIOSilence returns how long a client waits for the server's next
+// packet before giving up on it.
+func socketIOSilence(open eioOpenPacket) time.Duration {
+	d := time.Duration(open.PingInterval+open.PingTimeout) * time.Millisecond
+	if d <= 0 {
+		d = defaultKeepalive.silence()
+	}
+	return d
+}
+
+// UpgradeSocketIO upgrades an Engine.IO v4 WebSocket request, such as
+// GET /socket.io/?EIO=4&transport=websocket, and waits for the client to
+// join the default namespace. Other Engine.IO transports, such as HTTP long
+// polling, are refused with status 400.
+func (u *WebSocketUpgrader) UpgradeSocketIO(w http.ResponseWriter, r *http.Request) (*SocketIOTransport, error) {
+	q := r.URL.Query()
+	if q.Get("EIO") != "4" {
+		writeEngineIOError(w, 5, "Unsupported protocol version")
+		return nil, fmt.Errorf("%w: unsupported Engine.IO version %q", ErrSocketIOProtocol, q.Get("EIO"))
+	}
+	if q.Get("transport") != "websocket" {
+		writeEngineIOError(w, 0, "Transport unknown")
+		return nil, fmt.Errorf("%w: unsupported Engine.IO transport %q", ErrSocketIOProtocol, q.Get("transport"))
+	}
+	conn, info, err := u.upgrade(w, r)
+	if err != nil {
+		return nil, err
+	}
+	t, err := u.serverSocketIOHandshake(conn, info)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// serverSocketIOHandshake sends the Engine.IO open packet and admits the
+// client to the default namespace.
+func (u *WebSocketUpgrader) serverSocketIOHandshake(conn *websocket.Conn, requestInfo map[string]string) (*SocketIOTransport, error) {
+	ka := u.keepalive
+	if ka.interval <= 0 {
+		ka = defaultKeepalive
+	}
+	open, err := json.Marshal(eioOpenPacket{
+		SID:          randomID(),
+		Upgrades:     []string{},
+		PingInterval: ka.interval.Milliseconds(),
+		PingTimeout:  ka.timeout.Milliseconds(),
+		MaxPayload:   u.readLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(socketIOConnectTimeout)
+	conn.SetReadDeadline(deadline)
+	conn.SetWriteDeadline(deadline)
+	if err := conn.WriteMessage(websocket.TextMessage, append([]byte{eioOpen}, open...)); err != nil {
+		return nil, wsError(err)
+	}
+	for {
+		frame, err := readTextFrame(conn)
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) < 2 || frame[0] != eioMessage || frame[1] != sioConnect {
+			if len(frame) > 0 && frame[0] == eioClose {
+				return nil, fmt.Errorf("%w: client closed the connection", ErrClosed)
+			}
+			continue
+		}
+		if nsp, _ := splitNamespace(frame[2:]); nsp != "/" {
+			reply := fmt.Sprintf(`%c%c%s,{"message":"Invalid namespace"}`, eioMessage, sioConnectError, nsp)
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(reply)); err != nil {
+				return nil, wsError(err)
+			}
+			continue
+		}
+		sid := randomID()
+		ack := fmt.Sprintf(`%c%c{"sid":%q}`, eioMessage, sioConnect, sid)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(ack)); err != nil {
+			return nil, wsError(err)
+		}
+		info := map[string]string{"sid": sid}
+		for k, v := range requestInfo {
+			info[k] = v
+		}
+		t := newSocketIOTransport(conn, info)
+		go t.readLoop(ka.silence(), true)
+		go t.pingLoop(ka.interval)
+		return t, nil
+	}
+}
+
+func writeEngineIOError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprintf(w, `{"code":%d,"message":%q}`, code, msg)
+}
+
+func newSocketIOTransport(conn *websocket.Conn, info map[string]string) *SocketIOTransport {
+	conn.SetWriteDeadline(time.Time{})
+	return &SocketIOTransport{
+		conn:     conn,
+		info:     info,
+		incoming: make(chan []byte, 64),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+// readLoop reads packets until the connection fails, answering pings on the
+// client side and queueing SocketIOEvent arguments for Receive. The peer is
+// given up on after silence without any packet.
+func (t *SocketIOTransport) readLoop(silence time.Duration, server bool) {
+	defer close(t.done)
+	for {
+		t.conn.SetReadDeadline(time.Now().Add(silence))
+		frame, err := readTextFrame(t.conn)
+		if err != nil {
+			if errors.Is(err, ErrTimeout) {
+				err = peerDead(silence, err)
+				t.conn.Close()
+			}
+			t.err = err
+			return
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		switch frame[0] {
+		case eioPing:
+			if !server {
+				t.write(context.Background(), append([]byte{eioPong}, frame[1:]...))
+			}
+		case eioClose:
+			t.err = fmt.Errorf("%w: peer closed the connection", ErrClosed)
+			return
+		case eioMessage:
+			data, disconnected, err := parseSocketIOEvent(frame[1:])
+			if disconnected {
+				t.err = fmt.Errorf("%w: peer left the namespace", ErrClosed)
+				return
+			}
+			if err != nil || data == nil {
+				continue
+			}
+			select {
+			case t.incoming <- data:
+			case <-t.closed:
+				t.err = ErrClosed
+				return
+			}
+		}
+	}
+}
+
+// pingLoop sends a ping every interval until the transport stops.
+func (t *SocketIOTransport) pingLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if err := t.write(context.Background(), []byte{eioPing}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseSocketIOEvent returns the argument of a SocketIOEvent event on the
+// default namespace, nil for any other packet, and whether the packet ends
+// the connection.
+func parseSocketIOEvent(packet []byte) ([]byte, bool, error) {
+	if len(packet) == 0 {
+		return nil, false, nil
+	}
+	typ := packet[0]
+	nsp, rest := splitNamespace(packet[1:])
+	if nsp != "/" {
+		return nil, false, nil
+	}
+	switch typ {
+	case sioDisconnect:
+		return nil, true, nil
+	case sioEvent:
+	default:
+		return nil, false, nil
+	}
+	// Skip the acknowledgement id, if any; acknowledgements are not used.
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	var args []json.RawMessage
+	if err := json.Unmarshal(rest[i:], &args); err != nil {
+		return nil, false, fmt.Errorf("%w: malformed event: %w", ErrSocketIOProtocol, err)
+	}
+	var name string
+	if len(args) < 2 || json.Unmarshal(args[0], &name) != nil || name != SocketIOEvent {
+		return nil, false, nil
+	}
+	return args[1], false, nil
+}
+
+// splitNamespace splits the namespace, "/" if absent, from the rest of a
+// Socket.IO packet.
+func splitNamespace(packet []byte) (string, []byte) {
+	if len(packet) == 0 || packet[0] != '/' {
+		return "/", packet
+	}
+	if i := bytes.IndexByte(packet, ','); i >= 0 {
+		return string(packet[:i]), packet[i+1:]
+	}
+	return string(packet), nil
+}
+
+// readTextFrame reads the next text frame, skipping binary ones.
+func readTextFrame(conn *websocket.Conn) ([]byte, error) {
+	for {
+		typ, frame, err := conn.ReadMessage()
+		if err != nil {
+			return nil, wsError(err)
+		}
+		if typ == websocket.TextMessage {
+			return frame, nil
+		}
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 15)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// write sends one Engine.IO packet. Like WebSocketTransport.Send, it gives
+// up when ctx is done and closes the connection if the write fails.
+func (t *SocketIOTransport) write(ctx context.Context, packet []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	t.conn.SetWriteDeadline(deadline)
+	defer t.conn.SetWriteDeadline(time.Time{})
+	err := writeCancellable(ctx, t.conn, packet)
+	if err == nil {
+		return nil
+	}
+	// Not Close, which writes a disconnect packet first.
+	t.conn.Close()
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+	return wsError(err)
+}
+
+// Send emits data, which must be JSON, as a SocketIOEvent event. Cancelling
+// ctx and failed writes behave as for WebSocketTransport.Send.
+func (t *SocketIOTransport) Send(ctx context.Context, data []byte) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("%w: payload is not JSON", ErrSocketIOProtocol)
+	}
+	name := strconv.Quote(SocketIOEvent)
+	packet := make([]byte, 0, len(data)+len(name)+5)
+	packet = append(packet, eioMessage, sioEvent, '[')
+	packet = append(packet, name...)
+	packet = append(packet, ',')
+	packet = append(packet, data...)
+	packet = append(packet, ']')
+	return t.write(ctx, packet)
+}
+
+// Receive returns the argument of the next SocketIOEvent event.
+func (t *SocketIOTransport) Receive(ctx context.Context) ([]byte, error) {
+	return receive(ctx, t.incoming, t.done, &t.err)
+}
+
+// Metadata reports the remote address of the connection and the Socket.IO
+// session ID, and on the server side the request's origin and subprotocol.
+func (t *SocketIOTransport) Metadata() map[string]string {
+	md := map[string]string{"remoteAddr": t.conn.RemoteAddr().String()}
+	for k, v := range t.info {
+		md[k] = v
+	}
+	return md
+}
+
+// Close leaves the namespace and closes the connection.
+func (t *SocketIOTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		t.write(ctx, []byte{eioMessage, sioDisconnect})
+		cancel()
+		err = t.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// socketIOServer serves Socket.IO connections from u, handing each transport
+// to accepted.
+func socketIOServer(t *testing.T, u *WebSocketUpgrader) (string, <-chan *SocketIOTransport) {
+	t.Helper()
+	accepted := make(chan *SocketIOTransport, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tr, err := u.UpgradeSocketIO(w, r); err == nil {
+			accepted <- tr
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, accepted
+}
+
+func TestSocketIOTransport(t *testing.T) {
+	u := NewWebSocketUpgrader(WithKeepalive(20*time.Millisecond, DefaultPongTimeout))
+	url, accepted := socketIOServer(t, u)
+
+	client, err := NewSocketIOClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.(*SocketIOTransport).Close()
+	server := <-accepted
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Several ping intervals pass; the client's automatic pongs keep it alive.
+	time.Sleep(100 * time.Millisecond)
+	if err := client.Send(ctx, []byte(`{"type":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := server.Receive(ctx); err != nil || string(got) != `{"type":"hello"}` {
+		t.Fatalf("server got %q, %v", got, err)
+	}
+	if err := server.Send(ctx, []byte(`{"type":"nonce"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.Receive(ctx); err != nil || string(got) != `{"type":"nonce"}` {
+		t.Fatalf("client got %q, %v", got, err)
+	}
+	if server.Metadata()["sid"] == "" || server.Metadata()["sid"] != client.(*SocketIOTransport).Metadata()["sid"] {
+		t.Fatalf("socket ids differ: server %v, client %v", server.Metadata(), client.(*SocketIOTransport).Metadata())
+	}
+
+	client.(*SocketIOTransport).Close()
+	if _, err := server.Receive(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after the client left, got %v", err)
+	}
+}
+
+func TestSocketIOWireFormat(t *testing.T) {
+	u := NewWebSocketUpgrader(WithKeepalive(20*time.Millisecond, 30*time.Millisecond))
+	url, accepted := socketIOServer(t, u)
+	wsURL := "ws" + strings.TrimPrefix(url, "http") + "/socket.io/?EIO=4&transport=websocket"
+
+	// HTTP long polling is refused.
+	resp, err := http.Get(url + "/socket.io/?EIO=4&transport=polling")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("polling request got status %d, want 400", resp.StatusCode)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() string {
+		t.Helper()
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(frame)
+	}
+	write := func(frame string) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if open := read(); !strings.HasPrefix(open, `0{"sid":`) || !strings.Contains(open, `"pingInterval":20`) {
+		t.Fatalf("unexpected open packet %q", open)
+	}
+	write("40/admin,")
+	if reply := read(); reply != `44/admin,{"message":"Invalid namespace"}` {
+		t.Fatalf("unexpected reply to a foreign namespace %q", reply)
+	}
+	write("40")
+	if ack := read(); !strings.HasPrefix(ack, `40{"sid":`) {
+		t.Fatalf("unexpected connect ack %q", ack)
+	}
+	server := <-accepted
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Other events, namespaces and acknowledgement ids are handled.
+	write(`42["chat","ignored"]`)
+	write(`42/admin,["authMessage",{"n":0}]`)
+	write(`4217["authMessage",{"n":1}]`)
+	if got, err := server.Receive(ctx); err != nil || string(got) != `{"n":1}` {
+		t.Fatalf("server got %q, %v", got, err)
+	}
+	if err := server.Send(ctx, []byte(`{"n":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		frame := read()
+		if frame == "2" {
+			write("3")
+			continue
+		}
+		if frame != `42["authMessage",{"n":2}]` {
+			t.Fatalf("unexpected event %q", frame)
+		}
+		break
+	}
+
+	// A client that stops answering pings is given up on.
+	if _, err := server.Receive(ctx); !errors.Is(err, ErrPeerDead) || !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrPeerDead for a silent client, got %v", err)
+	}
+}
+
+func TestSocketIOTransportCancelledSend(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	url := wsServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"e","upgrades":[],"pingInterval":25000,"pingTimeout":20000}`))
+		conn.ReadMessage()
+		conn.WriteMessage(websocket.TextMessage, []byte(`40{"sid":"s"}`))
+		// Read nothing more, so a large write blocks
+		conn.NetConn().(*net.TCPConn).SetReadBuffer(4096)
+		<-release
+		conn.Close()
+	})
+	tr, err := NewSocketIOClient("http" + strings.TrimPrefix(url, "ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.(*SocketIOTransport).Close()
+	tr.(*SocketIOTransport).conn.NetConn().(*net.TCPConn).SetWriteBuffer(4096)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	payload := `"` + strings.Repeat("a", 1<<20) + `"`
+	time.AfterFunc(200*time.Millisecond, cancel)
+	if err := tr.Send(ctx, []byte(payload)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := tr.Send(ctx, []byte(`"late"`)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled for a cancelled context, got %v", err)
+	}
+
+	// As for WebSocketTransport, the connection is closed after a partial write.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tr.Receive(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
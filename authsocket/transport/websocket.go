@@ -2,6 +2,7 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -9,15 +10,83 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-// WebSocketTransport implements Transport over WebSocket for the client side.
+// WebSocket transports send a ping every DefaultPingInterval unless
+// configured otherwise, and consider the peer dead when nothing, not even a
+// pong, has arrived from it within DefaultPingInterval plus
+// DefaultPongTimeout. These match the defaults of socket.io.
+const (
+	DefaultPingInterval = 25 * time.Second
+	DefaultPongTimeout  = 20 * time.Second
+)
+
+// keepalive is how often a transport pings its peer and how long it then
+// waits for an answer.
+type keepalive struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+var defaultKeepalive = keepalive{interval: DefaultPingInterval, timeout: DefaultPongTimeout}
+
+// silence returns how long the peer may send nothing before it is considered
+// dead, or 0 if keepalive is disabled.
+func (k keepalive) silence() time.Duration {
+	if k.interval <= 0 {
+		return 0
+	}
+	return k.interval + k.timeout
+}
+
+// DialOption configures NewWebSocketClient.
+type DialOption func(*dialConfig)
+
+type dialConfig struct {
+	keepalive keepalive
+}
+
+// WithDialKeepalive pings the server every interval and gives up on it when
+// nothing has arrived within interval plus timeout, instead of
+// DefaultPingInterval and DefaultPongTimeout. An interval of 0 disables
+// pings and dead-peer detection.
+func WithDialKeepalive(interval, timeout time.Duration) DialOption {
+	return func(cfg *dialConfig) {
+		cfg.keepalive = keepalive{interval: interval, timeout: timeout}
+	}
+}
+
+// WebSocketTransport implements Transport over a WebSocket connection. It is
+// returned by NewWebSocketClient on the client side and by
+// WebSocketUpgrader.Upgrade on the server side.
+//
+// Reads and writes are independent: a reader goroutine queues incoming
+// messages for Receive, and only writers share a lock, so Send never waits
+// for a Receive. Cancelling the context of a blocked Receive returns at once
+// and leaves the connection usable.
+//
+// Both sides ping their peer, and answer its pings, while the connection is
+// idle. A peer that stops responding fails Receive with ErrPeerDead, which
+// also matches ErrClosed, and the connection is closed.
 type WebSocketTransport struct {
-	conn *websocket.Conn
-	mu   sync.Mutex
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	// info is added to Metadata; the server side records the request's
+	// origin and the negotiated subprotocol here.
+	info map[string]string
+
+	incoming  chan []byte
+	done      chan struct{} // closed when the reader stops
+	err       error         // why the reader stopped, set before done is closed
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // NewWebSocketClient connects to a WebSocket server and returns a Transport.
-func NewWebSocketClient(url string) (Transport, error) {
-	dialer := websocket.DefaultDialer
+func NewWebSocketClient(url string, opts ...DialOption) (Transport, error) {
+	cfg := &dialConfig{keepalive: defaultKeepalive}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	dialer := *websocket.DefaultDialer
 	dialer.HandshakeTimeout = 5 * time.Second
 
 	conn, _, err := dialer.Dial(url, nil)
@@ -25,12 +94,90 @@ func NewWebSocketClient(url string) (Transport, error) {
 		return nil, fmt.Errorf("dial websocket: %w", err)
 	}
 
-	return &WebSocketTransport{conn: conn}, nil
+	return newWebSocketTransport(conn, nil, cfg.keepalive), nil
+}
+
+// newWebSocketTransport wraps conn and starts its reader and, if ka is
+// enabled, its pings.
+func newWebSocketTransport(conn *websocket.Conn, info map[string]string, ka keepalive) *WebSocketTransport {
+	w := &WebSocketTransport{
+		conn:     conn,
+		info:     info,
+		incoming: make(chan []byte, 16),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	silence := ka.silence()
+	if silence > 0 {
+		// Any frame from the peer, including pings and pongs, shows it is alive
+		alive := func() { conn.SetReadDeadline(time.Now().Add(silence)) }
+		conn.SetPongHandler(func(string) error {
+			alive()
+			return nil
+		})
+		conn.SetPingHandler(func(data string) error {
+			alive()
+			conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(ka.timeout))
+			return nil
+		})
+		go w.pingLoop(ka)
+	}
+	go w.readLoop(silence)
+	return w
+}
+
+// readLoop queues incoming messages until the connection fails, or until
+// nothing has arrived from the peer for silence, if that is not 0.
+func (w *WebSocketTransport) readLoop(silence time.Duration) {
+	defer close(w.done)
+	for {
+		if silence > 0 {
+			w.conn.SetReadDeadline(time.Now().Add(silence))
+		}
+		_, message, err := w.conn.ReadMessage()
+		if err != nil {
+			w.err = wsError(err)
+			if silence > 0 && errors.Is(w.err, ErrTimeout) {
+				w.err = peerDead(silence, err)
+				w.conn.Close()
+			}
+			return
+		}
+		select {
+		case w.incoming <- message:
+		case <-w.closed:
+			w.err = ErrClosed
+			return
+		}
+	}
+}
+
+// pingLoop pings the peer every ka.interval until the reader stops.
+func (w *WebSocketTransport) pingLoop(ka keepalive) {
+	ticker := time.NewTicker(ka.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(ka.timeout)); err != nil && !errors.Is(wsError(err), ErrTimeout) {
+				return
+			}
+		}
+	}
 }
 
+// Send writes data as a text message. Without a deadline on ctx the write is
+// given 5 seconds. A write that fails, including one cut short by cancelling
+// ctx, leaves the connection unwritable, so the transport is closed and
+// Receive reports ErrClosed.
 func (w *WebSocketTransport) Send(ctx context.Context, data []byte) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
 
 	// Set write deadline
 	deadline, ok := ctx.Deadline()
@@ -38,34 +185,82 @@ func (w *WebSocketTransport) Send(ctx context.Context, data []byte) error {
 		deadline = time.Now().Add(5 * time.Second)
 	}
 	w.conn.SetWriteDeadline(deadline)
+	defer w.conn.SetWriteDeadline(time.Time{})
+	err := writeCancellable(ctx, w.conn, data)
+	if err == nil {
+		return nil
+	}
+	w.Close()
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+	return wsError(err)
+}
 
-	return w.conn.WriteMessage(websocket.TextMessage, data)
+// writeCancellable writes data as a text message on conn, cutting the write
+// short if ctx is cancelled. The caller must hold conn's write lock.
+func writeCancellable(ctx context.Context, conn *websocket.Conn, data []byte) error {
+	// The underlying connection's deadline is safe to set concurrently with
+	// the write; the websocket.Conn's is not.
+	cancelled := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		conn.NetConn().SetWriteDeadline(time.Now())
+		close(cancelled)
+	})
+	err := conn.WriteMessage(websocket.TextMessage, data)
+	if !stop() {
+		// Wait for the callback, so it cannot cut short a later write.
+		<-cancelled
+	}
+	return err
 }
 
+// Receive returns the next message, waiting until ctx is done or the
+// connection fails. An idle connection kept alive by pings does not fail.
 func (w *WebSocketTransport) Receive(ctx context.Context) ([]byte, error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	// Set read deadline
-	deadline, ok := ctx.Deadline()
-	if !ok {
-		deadline = time.Now().Add(5 * time.Second)
-	}
-	w.conn.SetReadDeadline(deadline)
+	return receive(ctx, w.incoming, w.done, &w.err)
+}
 
-	_, message, err := w.conn.ReadMessage()
-	if err != nil {
-		return nil, err
+// Metadata reports the remote address of the connection and, for transports
+// from WebSocketUpgrader, the request's origin and the negotiated subprotocol.
+func (w *WebSocketTransport) Metadata() map[string]string {
+	md := map[string]string{"remoteAddr": w.conn.RemoteAddr().String()}
+	for k, v := range w.info {
+		md[k] = v
 	}
-
-	return message, nil
+	return md
 }
 
+// Close closes the connection. Pending and later Receive calls fail with
+// ErrClosed once queued messages are drained.
 func (w *WebSocketTransport) Close() error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	return w.conn.Close()
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.closed)
+		err = w.conn.Close()
+	})
+	return err
 }
 
-// Note: For full WebSocket server integration, implement a server that accepts connections
-// and runs RunServerHandshake. For now, this is client-only transport.
+// receive returns the next message from incoming, or once done is closed
+// and incoming drained, the reader's error.
+func receive(ctx context.Context, incoming <-chan []byte, done <-chan struct{}, readErr *error) ([]byte, error) {
+	select {
+	case message := <-incoming:
+		return message, nil
+	default:
+	}
+	select {
+	case message := <-incoming:
+		return message, nil
+	case <-done:
+		select {
+		case message := <-incoming:
+			return message, nil
+		default:
+		}
+		return nil, *readErr
+	case <-ctx.Done():
+		return nil, contextError(ctx)
+	}
+}
@@ -1,15 +1,310 @@
 package transport
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
-// TestWebSocketTransport is a placeholder for WebSocket transport testing.
-// Full integration requires a running WebSocket server.
-// For now, this test ensures the transport can be created (but not connected).
 func TestWebSocketTransport(t *testing.T) {
-	// This is a placeholder test. To fully test, start a WebSocket server
-	// and connect with NewWebSocketClient("ws://localhost:port").
-	// Then run authsocket.RunClientHandshake.
-	t.Skip("WebSocket transport requires a running server for full testing")
+	l := NewWebSocketListener()
+	srv := httptest.NewServer(l)
+	t.Cleanup(srv.Close)
+	defer l.Close()
+
+	client, err := NewWebSocketClient("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server, err := l.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send(ctx, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := server.Receive(ctx); err != nil || string(got) != "ping" {
+		t.Fatalf("server got %q, %v", got, err)
+	}
+	if err := server.Send(ctx, []byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.Receive(ctx); err != nil || string(got) != "pong" {
+		t.Fatalf("client got %q, %v", got, err)
+	}
+	if server.Metadata()["remoteAddr"] == "" {
+		t.Fatal("server transport has no remoteAddr")
+	}
+
+	l.Close()
+	if _, err := l.Accept(ctx); !errors.Is(err, ErrListenerClosed) {
+		t.Fatalf("expected ErrListenerClosed, got %v", err)
+	}
+}
+
+func TestWebSocketUpgraderOptions(t *testing.T) {
+	accepted := make(chan *WebSocketTransport, 1)
+	u := NewWebSocketUpgrader(
+		WithAllowedOrigins("https://app.example.com"),
+		WithSubprotocols("authsocket.v2", "authsocket.v1"),
+		WithReadLimit(16),
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tr, err := u.Upgrade(w, r); err == nil {
+			accepted <- tr
+		}
+	}))
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	header := http.Header{"Origin": {"https://evil.example.com"}}
+	if _, resp, err := websocket.DefaultDialer.Dial(url, header); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected foreign origin to be rejected with 403, got %v", err)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{"authsocket.v1", "authsocket.v2"}}
+	header = http.Header{"Origin": {"https://APP.example.com"}}
+	conn, _, err := dialer.Dial(url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "authsocket.v2" {
+		t.Fatalf("negotiated %q, want the server's preference authsocket.v2", conn.Subprotocol())
+	}
+	server := <-accepted
+	md := server.Metadata()
+	if md["origin"] != "https://APP.example.com" || md["subprotocol"] != "authsocket.v2" {
+		t.Fatalf("unexpected metadata %v", md)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 17))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Receive(ctx); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+// wsServer starts a WebSocket server that hands each connection to handle.
+func wsServer(t *testing.T, handle func(*websocket.Conn)) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		handle(conn)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestWebSocketTransportErrors(t *testing.T) {
+	url := wsServer(t, func(conn *websocket.Conn) {
+		// Wait for one message, then close the connection
+		conn.ReadMessage()
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+		conn.Close()
+	})
+	tr, err := NewWebSocketClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tr.Receive(ctx); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	// A timed-out Receive leaves the connection usable
+	if err := tr.Send(context.Background(), []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Receive(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestWebSocketTransportCancelledSend(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	url := wsServer(t, func(conn *websocket.Conn) {
+		// Read nothing, so a large write blocks
+		conn.NetConn().(*net.TCPConn).SetReadBuffer(4096)
+		<-release
+		conn.Close()
+	})
+	tr, err := NewWebSocketClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.(*WebSocketTransport).Close()
+	tr.(*WebSocketTransport).conn.NetConn().(*net.TCPConn).SetWriteBuffer(4096)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	if err := tr.Send(ctx, make([]byte, 1<<20)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// The connection cannot be written to after a partial write, so it is closed.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tr.Receive(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := tr.Send(context.Background(), []byte("hi")); err == nil {
+		t.Fatal("expected Send on the closed transport to fail")
+	}
+}
+
+func TestWebSocketTransportFullDuplex(t *testing.T) {
+	l := NewWebSocketListener()
+	srv := httptest.NewServer(l)
+	t.Cleanup(srv.Close)
+	defer l.Close()
+	client, err := NewWebSocketClient("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.(*WebSocketTransport).Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server, err := l.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// A Receive blocked on an idle connection neither delays Send nor
+	// outlives its context.
+	blocked, stop := context.WithCancel(ctx)
+	received := make(chan error, 1)
+	go func() {
+		_, err := client.Receive(blocked)
+		received <- err
+	}()
+	start := time.Now()
+	if err := client.Send(ctx, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Send waited %s for a pending Receive", d)
+	}
+	stop()
+	if err := <-received; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if got, err := server.Receive(ctx); err != nil || string(got) != "ping" {
+		t.Fatalf("server got %q, %v", got, err)
+	}
+
+	// Both sides send and receive at once.
+	const n = 500
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for _, pair := range []struct{ from, to Transport }{{client, server}, {server, client}} {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if err := pair.from.Send(ctx, []byte(strconv.Itoa(i))); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				got, err := pair.to.Receive(ctx)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if string(got) != strconv.Itoa(i) {
+					errs <- fmt.Errorf("got message %s, want %d", got, i)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	t.Logf("%d messages each way in %s", n, time.Since(start))
+}
+
+func TestWebSocketKeepalive(t *testing.T) {
+	l := NewWebSocketListener(WithKeepalive(20*time.Millisecond, 30*time.Millisecond))
+	srv := httptest.NewServer(l)
+	t.Cleanup(srv.Close)
+	defer l.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An idle connection outlives many ping intervals without errors.
+	client, err := NewWebSocketClient(url, WithDialKeepalive(20*time.Millisecond, 30*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.(*WebSocketTransport).Close()
+	server, err := l.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	idle, stop := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer stop()
+	if _, err := server.Receive(idle); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the idle Receive to time out by its context, got %v", err)
+	}
+	if err := client.Send(ctx, []byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := server.Receive(ctx); err != nil || string(got) != "still here" {
+		t.Fatalf("server got %q, %v", got, err)
+	}
+
+	// A peer that stops reading never answers pings and is given up on.
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	server, err = l.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := server.Receive(ctx); !errors.Is(err, ErrPeerDead) || !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrPeerDead, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("dead peer detected after %s", d)
+	}
+	if err := server.Send(ctx, []byte("anyone?")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected Send on a dead connection to fail with ErrClosed, got %v", err)
+	}
 }
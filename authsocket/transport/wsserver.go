@@ -0,0 +1,209 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultReadLimit is the largest message, in bytes, a server-side WebSocket
+// transport accepts unless WithReadLimit says otherwise.
+const DefaultReadLimit = 1 << 20
+
+// ErrListenerClosed is returned by WebSocketListener.Accept once the listener
+// is closed.
+var ErrListenerClosed = errors.New("listener closed")
+
+// UpgraderOption configures a WebSocketUpgrader or WebSocketListener.
+type UpgraderOption func(*WebSocketUpgrader)
+
+// WithAllowedOrigins accepts browser requests only from the given origins,
+// such as "https://app.example.com"; "*" accepts any origin. Requests without
+// an Origin header, which browsers always send, are accepted. By default only
+// same-origin requests are accepted.
+func WithAllowedOrigins(origins ...string) UpgraderOption {
+	return func(u *WebSocketUpgrader) {
+		allowed := make([]string, len(origins))
+		for i, o := range origins {
+			allowed[i] = strings.TrimSuffix(strings.ToLower(o), "/")
+		}
+		u.upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+			for _, o := range allowed {
+				if o == "*" || o == origin {
+					return true
+				}
+			}
+			return false
+		}
+	}
+}
+
+// WithOriginCheck decides which requests to accept with check instead of the
+// same-origin default.
+func WithOriginCheck(check func(r *http.Request) bool) UpgraderOption {
+	return func(u *WebSocketUpgrader) {
+		u.upgrader.CheckOrigin = check
+	}
+}
+
+// WithSubprotocols offers the given subprotocols, most preferred first. The
+// first one the client also requested is negotiated and reported in the
+// transport's Metadata as "subprotocol"; clients requesting none of them are
+// still accepted, with no subprotocol.
+func WithSubprotocols(protocols ...string) UpgraderOption {
+	return func(u *WebSocketUpgrader) {
+		u.upgrader.Subprotocols = protocols
+	}
+}
+
+// WithReadLimit sets the largest message, in bytes, the transports accept
+// instead of DefaultReadLimit. A larger message fails Receive with
+// ErrMessageTooLarge and closes the connection.
+func WithReadLimit(n int64) UpgraderOption {
+	return func(u *WebSocketUpgrader) {
+		u.readLimit = n
+	}
+}
+
+// WithKeepalive pings each client every interval and gives up on it when
+// nothing has arrived within interval plus timeout, instead of
+// DefaultPingInterval and DefaultPongTimeout. Socket.IO clients are told to
+// expect these pings. An interval of 0 disables pings and dead-peer detection
+// on WebSocket transports; Socket.IO, which requires pings, then uses the
+// defaults.
+func WithKeepalive(interval, timeout time.Duration) UpgraderOption {
+	return func(u *WebSocketUpgrader) {
+		u.keepalive = keepalive{interval: interval, timeout: timeout}
+	}
+}
+
+// WebSocketUpgrader upgrades HTTP requests to WebSocket connections on the
+// server side and returns them as WebSocketTransports, with the same deadline
+// and concurrency behaviour as those from NewWebSocketClient.
+type WebSocketUpgrader struct {
+	upgrader  websocket.Upgrader
+	readLimit int64
+	keepalive keepalive
+}
+
+// NewWebSocketUpgrader returns an upgrader configured by opts.
+func NewWebSocketUpgrader(opts ...UpgraderOption) *WebSocketUpgrader {
+	u := &WebSocketUpgrader{
+		upgrader:  websocket.Upgrader{HandshakeTimeout: 5 * time.Second},
+		readLimit: DefaultReadLimit,
+		keepalive: defaultKeepalive,
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// Upgrade upgrades the request to a WebSocket connection. On failure, such as
+// a rejected origin, an HTTP error has already been written to w.
+func (u *WebSocketUpgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*WebSocketTransport, error) {
+	conn, info, err := u.upgrade(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return newWebSocketTransport(conn, info, u.keepalive), nil
+}
+
+// upgrade upgrades the request and returns the connection with the metadata
+// it adds.
+func (u *WebSocketUpgrader) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, map[string]string, error) {
+	conn, err := u.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("upgrade websocket: %w", err)
+	}
+	conn.SetReadLimit(u.readLimit)
+	info := map[string]string{}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		info["origin"] = origin
+	}
+	if p := conn.Subprotocol(); p != "" {
+		info["subprotocol"] = p
+	}
+	return conn, info, nil
+}
+
+// WebSocketListener is an http.Handler that upgrades each request and hands
+// the transport to Accept, in the manner of a net.Listener:
+//
+//	l := transport.NewWebSocketListener(transport.WithAllowedOrigins("https://app.example.com"))
+//	http.Handle("/ws", l)
+//	for {
+//		t, err := l.Accept(ctx)
+//		...
+//		go server.AcceptClient(ctx, t)
+//	}
+type WebSocketListener struct {
+	upgrader *WebSocketUpgrader
+	conns    chan *WebSocketTransport
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NewWebSocketListener returns a listener whose upgrader is configured by
+// opts.
+func NewWebSocketListener(opts ...UpgraderOption) *WebSocketListener {
+	return &WebSocketListener{
+		upgrader: NewWebSocketUpgrader(opts...),
+		conns:    make(chan *WebSocketTransport),
+		closed:   make(chan struct{}),
+	}
+}
+
+// ServeHTTP upgrades the request and waits for Accept to take the transport.
+// If the listener is closed, or the request is cancelled first, the
+// connection is closed instead.
+func (l *WebSocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-l.closed:
+		http.Error(w, ErrListenerClosed.Error(), http.StatusServiceUnavailable)
+		return
+	default:
+	}
+	t, err := l.upgrader.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	select {
+	case l.conns <- t:
+	case <-l.closed:
+		t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+		t.Close()
+	case <-r.Context().Done():
+		t.Close()
+	}
+}
+
+// Accept waits for the next upgraded connection.
+func (l *WebSocketListener) Accept(ctx context.Context) (*WebSocketTransport, error) {
+	select {
+	case t := <-l.conns:
+		return t, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	case <-ctx.Done():
+		return nil, contextError(ctx)
+	}
+}
+
+// Close stops the listener. Pending and later Accept calls fail with
+// ErrListenerClosed; connections already accepted are left open.
+func (l *WebSocketListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
@@ -1,17 +1,58 @@
 package authsocket
 
-import "errors"
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+)
 
 func BytesFromIntArray(a []int) []byte {
-    b := make([]byte, len(a))
-    for i, v := range a { b[i] = byte(v) }
-    return b
+	b := make([]byte, len(a))
+	for i, v := range a {
+		b[i] = byte(v)
+	}
+	return b
 }
 
 func IntsFromBytes(b []byte) []int {
-    out := make([]int, len(b))
-    for i, v := range b { out[i] = int(v) }
-    return out
+	out := make([]int, len(b))
+	for i, v := range b {
+		out[i] = int(v)
+	}
+	return out
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeMessage parses an AuthMessage, failing with ErrMalformedMessage.
+func decodeMessage(raw []byte) (*message.AuthMessage, error) {
+	var am message.AuthMessage
+	if err := json.Unmarshal(raw, &am); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+	}
+	return &am, nil
+}
+
+func unexpectedMessage(got, want string) error {
+	return fmt.Errorf("%w: got %q, want %q", ErrUnexpectedMessage, got, want)
 }
 
-var ErrInvalidHandshake = errors.New("invalid handshake")
+// messageType returns the type of an AuthMessage, or "" if raw is not one.
+func messageType(raw []byte) string {
+	var am struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(raw, &am)
+	return am.Type
+}
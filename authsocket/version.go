@@ -0,0 +1,38 @@
+package authsocket
+
+import "github.com/sirdeggen/go-authsocket/authsocket/message"
+
+// SupportedVersions lists the protocol versions this package speaks, most
+// preferred first. Clients advertise them in the hello and servers select the
+// first of them the client also supports.
+var SupportedVersions = []string{message.Version}
+
+// selectVersion returns the first of preferred that also appears in offered.
+func selectVersion(preferred, offered []string) (string, bool) {
+	for _, v := range preferred {
+		if contains(offered, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// intersect returns the elements of a that also appear in b, in a's order.
+func intersect(a, b []string) []string {
+	var out []string
+	for _, v := range a {
+		if contains(b, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/message"
+)
+
+func TestVersionNegotiation(t *testing.T) {
+	client, server, clientErr, serverErr := runHandshakePair(t, nil,
+		[]ClientOption{WithFeatures("compression", "resume")},
+		[]ServerOption{WithAcceptedFeatures("resume", "batching")})
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if client.Version != message.Version || server.Version != message.Version {
+		t.Fatalf("negotiated versions %q and %q, want %q", client.Version, server.Version, message.Version)
+	}
+	for _, s := range []*Session{client, server} {
+		if len(s.Features) != 1 || s.Features[0] != "resume" {
+			t.Fatalf("negotiated features %v, want [resume]", s.Features)
+		}
+	}
+}
+
+func TestVersionNegotiationUnsupported(t *testing.T) {
+	start := time.Now()
+	_, _, clientErr, serverErr := runHandshakePair(t, nil, []ClientOption{WithVersions("2")}, nil)
+	if !errors.Is(serverErr, ErrUnsupportedVersion) {
+		t.Fatalf("server: expected ErrUnsupportedVersion, got %v", serverErr)
+	}
+	if !errors.Is(clientErr, ErrUnsupportedVersion) {
+		t.Fatalf("client: expected ErrUnsupportedVersion, got %v", clientErr)
+	}
+	// The client learns of the failure from the server's error message rather
+	// than by waiting for its context to expire.
+	if time.Since(start) > time.Second {
+		t.Fatalf("client took %v to fail", time.Since(start))
+	}
+}
+
+func TestVersionNegotiationPrefersServerOrder(t *testing.T) {
+	client, server, clientErr, serverErr := runHandshakePair(t, nil,
+		[]ClientOption{WithVersions(message.Version, "2")},
+		[]ServerOption{WithAcceptedVersions("2", message.Version)})
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if client.Version != "2" || server.Version != "2" {
+		t.Fatalf("negotiated versions %q and %q, want 2", client.Version, server.Version)
+	}
+}
+
+func TestVersionDowngradeDetected(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(identity.MustFromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"))
+	c.Versions = []string{"2", message.Version}
+	c.Features = []string{"resume"}
+	s := NewServer(demoKeypair())
+	s.Versions = []string{"2", message.Version}
+	s.Features = []string{"resume"}
+
+	hello, err := c.Hello(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A man in the middle strips the newer version and the feature.
+	var am message.AuthMessage
+	if err := json.Unmarshal(hello, &am); err != nil {
+		t.Fatal(err)
+	}
+	am.Version = message.Version
+	am.SupportedVersions = []string{message.Version}
+	am.Features = nil
+	stripped, err := json.Marshal(am)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := s.HandleHello(ctx, stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.HandleNonce(ctx, nonce); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for a downgraded hello, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package authsocket
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/wallet"
+)
+
+// Wallet holds an identity key on behalf of a handshake party. It is the key
+// subset of go-sdk's wallet.Interface, so any go-sdk wallet can be used, as
+// can *wallet.ProtoWallet for a local private key. The private key never
+// leaves the wallet: handshake and message signatures are made with keys
+// derived for the counterparty under SignatureProtocol, and certificate
+// fields are decrypted through it.
+type Wallet interface {
+	wallet.KeyOperations
+}
+
+// SignatureProtocol is the wallet protocol under which handshake and general
+// message signatures are created and verified. The key ID is the session ID.
+var SignatureProtocol = wallet.Protocol{
+	SecurityLevel: wallet.SecurityLevelEveryAppAndCounterparty,
+	Protocol:      "auth message signature",
+}
+
+// SessionKeyProtocol is the wallet protocol under which both sides derive the
+// symmetric key that encrypts general message payloads. The key ID is the
+// session ID and the key is the HMAC of the client and server nonces, keyed
+// by the ECDH secret of the two identities.
+var SessionKeyProtocol = wallet.Protocol{
+	SecurityLevel: wallet.SecurityLevelEveryAppAndCounterparty,
+	Protocol:      "authsocket session key",
+}
+
+// identityKey returns the compressed hex identity key of w.
+func identityKey(ctx context.Context, w Wallet) (string, error) {
+	res, err := w.GetPublicKey(ctx, wallet.GetPublicKeyArgs{IdentityKey: true}, "")
+	if err != nil {
+		return "", fmt.Errorf("%w: get identity key: %w", ErrWallet, err)
+	}
+	return hex.EncodeToString(res.PublicKey.Compressed()), nil
+}
+
+func signatureArgs(counterparty *ec.PublicKey, keyID string) wallet.EncryptionArgs {
+	return wallet.EncryptionArgs{
+		ProtocolID:   SignatureProtocol,
+		KeyID:        keyID,
+		Counterparty: wallet.Counterparty{Type: wallet.CounterpartyTypeOther, Counterparty: counterparty},
+	}
+}
+
+// createSignature signs data for the counterparty identity key and returns the
+// DER signature in hex.
+func createSignature(ctx context.Context, w Wallet, counterpartyKey, keyID string, data []byte) (string, error) {
+	counterparty, err := ec.PublicKeyFromString(counterpartyKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: parse counterparty key: %w", ErrInvalidHandshake, err)
+	}
+	res, err := w.CreateSignature(ctx, wallet.CreateSignatureArgs{
+		EncryptionArgs: signatureArgs(counterparty, keyID),
+		Data:           data,
+	}, "")
+	if err != nil {
+		return "", fmt.Errorf("%w: create signature: %w", ErrWallet, err)
+	}
+	return hex.EncodeToString(res.Signature.Serialize()), nil
+}
+
+// verifySignature checks that signerKey signed data for w's identity. It
+// returns ErrInvalidSignature for malformed or non-matching signatures, and
+// ErrWallet if the wallet could not check the signature at all.
+func verifySignature(ctx context.Context, w Wallet, signerKey, keyID string, data []byte, sigHex string) error {
+	signer, err := ec.PublicKeyFromString(signerKey)
+	if err != nil {
+		return fmt.Errorf("%w: parse signer key: %w", ErrInvalidSignature, err)
+	}
+	sigBytes, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return fmt.Errorf("%w: decode signature: %w", ErrInvalidSignature, err)
+	}
+	sig, err := ec.ParseSignature(sigBytes)
+	if err != nil {
+		return fmt.Errorf("%w: parse signature: %w", ErrInvalidSignature, err)
+	}
+	res, err := w.VerifySignature(ctx, wallet.VerifySignatureArgs{
+		EncryptionArgs: signatureArgs(signer, keyID),
+		Data:           data,
+		Signature:      sig,
+	}, "")
+	if err != nil {
+		return fmt.Errorf("%w: verify signature: %w", ErrWallet, err)
+	}
+	if !res.Valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// deriveSessionKey returns the 32-byte payload key w shares with the
+// counterparty for the session.
+func deriveSessionKey(ctx context.Context, w Wallet, counterpartyKey, sessionID string, nonces []byte) ([]byte, error) {
+	counterparty, err := ec.PublicKeyFromString(counterpartyKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse counterparty key: %w", err)
+	}
+	res, err := w.CreateHMAC(ctx, wallet.CreateHMACArgs{
+		EncryptionArgs: wallet.EncryptionArgs{
+			ProtocolID:   SessionKeyProtocol,
+			KeyID:        sessionID,
+			Counterparty: wallet.Counterparty{Type: wallet.CounterpartyTypeOther, Counterparty: counterparty},
+		},
+		Data: nonces,
+	}, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: derive session key: %w", ErrWallet, err)
+	}
+	return res.HMAC[:], nil
+}
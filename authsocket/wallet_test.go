@@ -0,0 +1,74 @@
+package authsocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	ec "github.com/bsv-blockchain/go-sdk/primitives/ec"
+	"github.com/bsv-blockchain/go-sdk/wallet"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
+)
+
+func protoWallet(t *testing.T, hexpriv string) *wallet.ProtoWallet {
+	t.Helper()
+	priv, err := ec.PrivateKeyFromHex(hexpriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := wallet.NewProtoWallet(wallet.ProtoWalletArgs{Type: wallet.ProtoWalletArgsTypePrivateKey, PrivateKey: priv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pw
+}
+
+func TestHandshakeWithSDKWallets(t *testing.T) {
+	clientWallet := protoWallet(t, "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	serverWallet := protoWallet(t, "1a2b3c4d5e6f708192a3b4c5d6e7f8090a1b2c3d4e5f60718293a4b5c6d7e8f9")
+
+	clientT, serverT := transport.InMemoryPair()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var serverSession *Session
+	var serverErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serverSession, serverErr = RunServerHandshake(ctx, serverT, serverWallet)
+	}()
+	clientSession, err := RunClientHandshake(ctx, clientT, clientWallet)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+	if serverErr != nil {
+		t.Fatalf("server error: %v", serverErr)
+	}
+
+	clientKey, err := identityKey(ctx, clientWallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverSession.PeerIdentityKey != clientKey {
+		t.Fatalf("server session has client identity %s, want %s", serverSession.PeerIdentityKey, clientKey)
+	}
+	if clientSession.PeerIdentityKey != serverSession.LocalIdentityKey {
+		t.Fatalf("client session has server identity %s, want %s", clientSession.PeerIdentityKey, serverSession.LocalIdentityKey)
+	}
+
+	raw, err := clientSession.Seal(ctx, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := serverSession.Open(ctx, raw)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if string(payload) != "hi" {
+		t.Fatalf("got %q, want %q", payload, "hi")
+	}
+}
@@ -6,67 +6,38 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/gorilla/websocket"
 	"github.com/sirdeggen/go-authsocket/authsocket"
-	"github.com/sirdeggen/go-authsocket/internal/wire"
+	"github.com/sirdeggen/go-authsocket/authsocket/identity"
+	"github.com/sirdeggen/go-authsocket/authsocket/transport"
 )
 
 func main() {
-	// Server wallet (dummy, as server doesn't sign in this test)
-	wallet, _ := wire.NewKeyPairFromHex("030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f22")
+	// Server wallet, used to sign the nonce so clients can authenticate the server
+	wallet, _ := identity.FromHex("030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2223")
 
 	server := authsocket.NewAuthSocketServer(nil, wallet) // Transport set per connection
 
-	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
-	}
+	ctx := context.Background()
 
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println("upgrade error:", err)
-			return
-		}
-		defer conn.Close()
-
-		wsTransport := &webSocketTransport{conn: conn}
-
-		ctx := context.Background()
-		err = server.AcceptClient(ctx, wsTransport)
-		if err != nil {
-			log.Println("accept client error:", err)
-			return
-		}
-
-		// Broadcast a welcome message
-		server.Emit(ctx, "message", map[string]string{"from": "Server", "text": "Welcome!"})
-
-		// Listen for messages (in a real app, handle properly)
-		for {
-			data, err := wsTransport.Receive(ctx)
-			if err != nil {
-				break
-			}
-			// Parse and broadcast
-			// For simplicity, just log
-			log.Println("Received message:", string(data))
-		}
+	// Relay every verified chat message to all clients
+	server.On("message", func(identityKey string, data interface{}) {
+		log.Printf("Received message from %s: %v", identityKey, data)
+		server.Emit(ctx, "message", data)
+	})
+	server.OnError(func(identityKey string, err error) {
+		log.Printf("Client %s: %v", identityKey, err)
+	})
+	server.OnDisconnect(func(identityKey string, err error) {
+		log.Printf("Client %s disconnected: %v", identityKey, err)
 	})
 
+	// The handlers upgrade, authenticate and serve each connection. The
+	// TypeScript client speaks Socket.IO on /socket.io/, Go clients can also
+	// use plain WebSocket on /ws; both connect from any origin
+	anyOrigin := transport.WithAllowedOrigins("*")
+	http.Handle("/socket.io/", server.SocketIOHandler(anyOrigin))
+	http.Handle("/ws", server.Handler(anyOrigin))
+
 	fmt.Println("Starting authsocket server on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
-
-// webSocketTransport implements transport.Transport
-type webSocketTransport struct {
-	conn *websocket.Conn
-}
-
-func (w *webSocketTransport) Send(ctx context.Context, data []byte) error {
-	return w.conn.WriteMessage(websocket.TextMessage, data)
-}
-
-func (w *webSocketTransport) Receive(ctx context.Context) ([]byte, error) {
-	_, message, err := w.conn.ReadMessage()
-	return message, err
-}
\ No newline at end of file
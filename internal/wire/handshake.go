@@ -1,16 +1,182 @@
 package wire
 
 import (
-    "crypto/rand"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Roles distinguish the client's and the server's handshake signatures so
+// neither can be reflected back as the other.
+const (
+	RoleClient = "client"
+	RoleServer = "server"
 )
 
 // MakeNonceIntArray generates a random 32-byte nonce and returns it as []int (0-255).
 func MakeNonceIntArray() []int {
-    b := make([]byte, 32)
-    _, _ = rand.Read(b)
-    out := make([]int, len(b))
-    for i := range b {
-        out[i] = int(b[i])
-    }
-    return out
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	out := make([]int, len(b))
+	for i := range b {
+		out[i] = int(b[i])
+	}
+	return out
+}
+
+// HandshakeTag opens every handshake preimage, so an authsocket handshake
+// signature cannot be mistaken for a signature in another protocol.
+const HandshakeTag = "authsocket handshake"
+
+// HandshakeParams are the values a handshake signature commits to.
+type HandshakeParams struct {
+	Role     string
+	Version  string
+	Features []string
+	// OfferedVersions and OfferedFeatures are the supportedVersions and
+	// features of the client's hello, as sent.
+	OfferedVersions   []string
+	OfferedFeatures   []string
+	Origin            string
+	ClientNonce       []byte
+	ServerNonce       []byte
+	ClientIdentityKey string
+	ServerIdentityKey string
+}
+
+// HandshakePreimage returns the bytes a handshake party signs: the fields
+// HandshakeTag, role, version, features, offered versions, offered features,
+// origin, client nonce, server nonce, client identity key and server identity
+// key, each prefixed with its length as a big-endian uint32. A list field is
+// its items, each length-prefixed the same way, and the identity keys are in
+// compressed binary form. Covering both nonces and both keys binds the
+// signature to exactly one session between two parties. Covering what the
+// client offered as well as what was selected means a hello stripped of
+// versions or features in transit fails both signatures.
+func HandshakePreimage(p HandshakeParams) ([]byte, error) {
+	clientKey, err := hex.DecodeString(p.ClientIdentityKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode client identity key: %w", err)
+	}
+	serverKey, err := hex.DecodeString(p.ServerIdentityKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode server identity key: %w", err)
+	}
+	return lengthPrefixed(
+		[]byte(HandshakeTag),
+		[]byte(p.Role),
+		[]byte(p.Version),
+		list(p.Features),
+		list(p.OfferedVersions),
+		list(p.OfferedFeatures),
+		[]byte(p.Origin),
+		p.ClientNonce,
+		p.ServerNonce,
+		clientKey,
+		serverKey,
+	), nil
+}
+
+// ResumeTag opens every resumption preimage.
+const ResumeTag = "authsocket resume"
+
+// ResumePreimage returns the bytes signed to resume a session: the fields
+// ResumeTag, role, session ID (binary), client nonce and ticket, each
+// prefixed with its length as a big-endian uint32. The client signs the
+// ticket it presents and the server the ticket it issues in reply.
+func ResumePreimage(role, sessionID string, clientNonce []byte, ticket string) ([]byte, error) {
+	id, err := hex.DecodeString(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("decode session id: %w", err)
+	}
+	return lengthPrefixed([]byte(ResumeTag), []byte(role), id, clientNonce, []byte(ticket)), nil
+}
+
+// ReauthTag opens every re-authentication preimage.
+const ReauthTag = "authsocket reauth"
+
+// ReauthPreimage returns the bytes a client signs to answer a server's
+// re-authentication challenge: the fields ReauthTag, session ID (binary) and
+// challenge nonce, each prefixed with its length as a big-endian uint32.
+func ReauthPreimage(sessionID string, challenge []byte) ([]byte, error) {
+	id, err := hex.DecodeString(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("decode session id: %w", err)
+	}
+	return lengthPrefixed([]byte(ReauthTag), id, challenge), nil
+}
+
+// lengthPrefixed concatenates fields, each prefixed with its length as a
+// big-endian uint32.
+func lengthPrefixed(fields ...[]byte) []byte {
+	var out []byte
+	for _, f := range fields {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(f)))
+		out = append(out, f...)
+	}
+	return out
+}
+
+// list encodes items as one preimage field, each item length-prefixed so
+// that no two lists encode the same.
+func list(items []string) []byte {
+	fields := make([][]byte, len(items))
+	for i, item := range items {
+		fields[i] = []byte(item)
+	}
+	return lengthPrefixed(fields...)
+}
+
+// NormalizeOrigin reduces a URL to the origin covered by handshake
+// signatures: lowercase scheme "://" host, with ws mapped to http, wss to
+// https, default ports dropped and any path, query or fragment removed.
+// Values that do not parse as an absolute URL are returned unchanged.
+func NormalizeOrigin(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return raw
+	}
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "ws":
+		scheme = "http"
+	case "wss":
+		scheme = "https"
+	}
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	return scheme + "://" + host
+}
+
+// SessionID derives the identifier both sides share for a session from the
+// client and server nonces.
+func SessionID(clientNonce, serverNonce []byte) string {
+	h := sha256.New()
+	h.Write(clientNonce)
+	h.Write(serverNonce)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MessagePreimage returns the bytes signed for a post-handshake general
+// message: "general" || sessionID || seq || payload, with the session ID in
+// binary form and the sequence number as a big-endian uint64.
+func MessagePreimage(sessionID string, seq uint64, payload []byte) ([]byte, error) {
+	id, err := hex.DecodeString(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("decode session id: %w", err)
+	}
+	out := make([]byte, 0, len("general")+len(id)+8+len(payload))
+	out = append(out, "general"...)
+	out = append(out, id...)
+	out = binary.BigEndian.AppendUint64(out, seq)
+	return append(out, payload...), nil
 }
@@ -0,0 +1,86 @@
+package wire
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// vectors are shared with other implementations of the protocol.
+type vectors struct {
+	Preimages []struct {
+		Role              string   `json:"role"`
+		Version           string   `json:"version"`
+		Features          []string `json:"features"`
+		OfferedVersions   []string `json:"offeredVersions"`
+		OfferedFeatures   []string `json:"offeredFeatures"`
+		Origin            string   `json:"origin"`
+		ClientNonce       string   `json:"clientNonce"`
+		ServerNonce       string   `json:"serverNonce"`
+		ClientIdentityKey string   `json:"clientIdentityKey"`
+		ServerIdentityKey string   `json:"serverIdentityKey"`
+		Preimage          string   `json:"preimage"`
+	} `json:"preimages"`
+	Origins []struct {
+		URL    string `json:"url"`
+		Origin string `json:"origin"`
+	} `json:"origins"`
+}
+
+func loadVectors(t *testing.T) vectors {
+	t.Helper()
+	raw, err := os.ReadFile("testdata/handshake_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v vectors
+	if err := json.Unmarshal(raw, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestHandshakePreimageVectors(t *testing.T) {
+	for i, v := range loadVectors(t).Preimages {
+		clientNonce, _ := hex.DecodeString(v.ClientNonce)
+		serverNonce, _ := hex.DecodeString(v.ServerNonce)
+		got, err := HandshakePreimage(HandshakeParams{
+			Role:              v.Role,
+			Version:           v.Version,
+			Features:          v.Features,
+			OfferedVersions:   v.OfferedVersions,
+			OfferedFeatures:   v.OfferedFeatures,
+			Origin:            v.Origin,
+			ClientNonce:       clientNonce,
+			ServerNonce:       serverNonce,
+			ClientIdentityKey: v.ClientIdentityKey,
+			ServerIdentityKey: v.ServerIdentityKey,
+		})
+		if err != nil {
+			t.Fatalf("vector %d: %v", i, err)
+		}
+		if hex.EncodeToString(got) != v.Preimage {
+			t.Fatalf("vector %d: got %x, want %s", i, got, v.Preimage)
+		}
+	}
+}
+
+func TestHandshakePreimageSeparatesFeatures(t *testing.T) {
+	params := HandshakeParams{ClientIdentityKey: "02", ServerIdentityKey: "03"}
+	params.Features = []string{"a,b"}
+	joined, _ := HandshakePreimage(params)
+	params.Features = []string{"a", "b"}
+	separate, _ := HandshakePreimage(params)
+	if string(joined) == string(separate) {
+		t.Fatal(`features ["a,b"] and ["a", "b"] have the same preimage`)
+	}
+}
+
+func TestNormalizeOriginVectors(t *testing.T) {
+	for _, v := range loadVectors(t).Origins {
+		if got := NormalizeOrigin(v.URL); got != v.Origin {
+			t.Fatalf("NormalizeOrigin(%q) = %q, want %q", v.URL, got, v.Origin)
+		}
+	}
+}